@@ -0,0 +1,158 @@
+// Package auth provides the credentials repon authenticates to GitHub with,
+// as OAuth2 token sources.
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// defaultAPIURL is the REST API URL of github.com.
+	defaultAPIURL = "https://api.github.com/"
+	// jwtLifetime is how long the JWT for an app is valid. GitHub allows at most
+	// ten minutes.
+	jwtLifetime = 9 * time.Minute
+	// clockSkew is how far the JWT's issued at time is backdated, in case our
+	// clock is ahead of GitHub's.
+	clockSkew = time.Minute
+	// refreshBefore is how long before an installation token expires that it's
+	// refreshed, so requests in flight don't use an expired token.
+	refreshBefore = 5 * time.Minute
+)
+
+// App authenticates as a GitHub App installation. Installation tokens are
+// requested with a JWT signed by the app's private key.
+//
+// See https://docs.github.com/en/free-pro-team@latest/developers/apps/authenticating-with-github-apps.
+type App struct {
+	// ID is the app's ID.
+	ID int64
+	// InstallationID is the ID of the app's installation on the org or user
+	// whose repos are listed.
+	InstallationID int64
+	// Key is the app's private key.
+	Key *rsa.PrivateKey
+	// APIURL is the REST API URL tokens are requested from. If empty, github.com
+	// is used.
+	APIURL string
+	// Client is the client tokens are requested with. If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+}
+
+// TokenSource returns a token source for the app's installation tokens, which
+// are reused until shortly before they expire.
+func (a *App) TokenSource() oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, a)
+}
+
+// Token requests a new installation token. It implements oauth2.TokenSource,
+// but doesn't reuse tokens, see TokenSource.
+func (a *App) Token() (*oauth2.Token, error) {
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	apiURL := a.APIURL
+	if apiURL == "" {
+		apiURL = defaultAPIURL
+	}
+	if !strings.HasSuffix(apiURL, "/") {
+		apiURL += "/"
+	}
+	url := fmt.Sprintf("%sapp/installations/%d/access_tokens", apiURL, a.InstallationID)
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting installation token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("requesting installation token: %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding installation token: %v", err)
+	}
+	return &oauth2.Token{
+		AccessToken: body.Token,
+		TokenType:   "token",
+		Expiry:      body.ExpiresAt.Add(-refreshBefore),
+	}, nil
+}
+
+// jwt returns a JWT for the app signed with RS256, valid from now.
+func (a *App) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-clockSkew).Unix(),
+		"exp": now.Add(jwtLifetime).Unix(),
+		"iss": a.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing JWT: %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// ParsePrivateKey parses a PEM encoded RSA private key, as downloaded from a
+// GitHub App's settings.
+func ParsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is a %T, not an RSA key", key)
+	}
+	return rsaKey, nil
+}
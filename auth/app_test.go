@@ -0,0 +1,172 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v33/github"
+	"github.com/vtsao/repon/auth"
+	"github.com/vtsao/repon/internal/fakegithub"
+	"github.com/vtsao/repon/repo"
+	"github.com/vtsao/repon/topn"
+	"golang.org/x/oauth2"
+)
+
+const (
+	appID          = 1234
+	installationID = 5678
+)
+
+// newKey generates a private key for a fake app.
+func newKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	return key
+}
+
+func TestAppTokenSource(t *testing.T) {
+	key := newKey(t)
+
+	tests := []struct {
+		desc       string
+		app        auth.App
+		ttl        time.Duration
+		wantTokens []string
+		wantErr    bool
+	}{
+		{
+			desc:       "reuses token",
+			app:        auth.App{ID: appID, InstallationID: installationID, Key: key},
+			ttl:        time.Hour,
+			wantTokens: []string{"ghs_1", "ghs_1"},
+		},
+		{
+			desc:       "refreshes token before it expires",
+			app:        auth.App{ID: appID, InstallationID: installationID, Key: key},
+			ttl:        time.Minute,
+			wantTokens: []string{"ghs_1", "ghs_2"},
+		},
+		{
+			desc:    "wrong app",
+			app:     auth.App{ID: appID + 1, InstallationID: installationID, Key: key},
+			ttl:     time.Hour,
+			wantErr: true,
+		},
+		{
+			desc:    "wrong installation",
+			app:     auth.App{ID: appID, InstallationID: installationID + 1, Key: key},
+			ttl:     time.Hour,
+			wantErr: true,
+		},
+		{
+			desc:    "wrong key",
+			app:     auth.App{ID: appID, InstallationID: installationID, Key: newKey(t)},
+			ttl:     time.Hour,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			serv := fakegithub.NewRESTServer(t, fakegithub.Netflix(), fakegithub.WithApp(appID, installationID, &key.PublicKey, tt.ttl))
+			defer serv.Close()
+			tt.app.APIURL = serv.URL
+			src := tt.app.TokenSource()
+
+			var tokens []string
+			for i := 0; i < 2; i++ {
+				token, err := src.Token()
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Token() got error %v, want error: %v", err, tt.wantErr)
+				}
+				if tt.wantErr {
+					return
+				}
+				tokens = append(tokens, token.AccessToken)
+			}
+			if diff := cmp.Diff(tt.wantTokens, tokens); diff != "" {
+				t.Errorf("Token() got diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAppListRepos(t *testing.T) {
+	key := newKey(t)
+	serv := fakegithub.NewRESTServer(t, fakegithub.Netflix(), fakegithub.WithApp(appID, installationID, &key.PublicKey, time.Hour))
+	defer serv.Close()
+
+	app := &auth.App{ID: appID, InstallationID: installationID, Key: key, APIURL: serv.URL}
+	client := github.NewClient(&http.Client{Transport: &oauth2.Transport{Source: app.TokenSource()}})
+	client.BaseURL = fakegithub.BaseURL(t, serv)
+	backend := repo.TopN{Client: client, FillPRsConcurrency: 1}
+
+	repos, err := backend.List(context.Background(), "netflix", 2, "stars")
+	if err != nil {
+		t.Fatalf(`List("netflix", 2, "stars") failed: %v`, err)
+	}
+
+	wantRepos := []*topn.Repo{
+		{Name: "metaflow", Stars: 20787, Forks: 2963},
+		{Name: "Hystrix", Stars: 10248, Forks: 728},
+	}
+	if diff := cmp.Diff(wantRepos, repos); diff != "" {
+		t.Errorf(`List("netflix", 2, "stars") got diff (-want +got):\n%s`, diff)
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key := newKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() failed: %v", err)
+	}
+
+	tests := []struct {
+		desc    string
+		pem     []byte
+		wantErr bool
+	}{
+		{
+			desc: "PKCS #1",
+			pem:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		},
+		{
+			desc: "PKCS #8",
+			pem:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		},
+		{
+			desc:    "not PEM",
+			pem:     []byte("not a key"),
+			wantErr: true,
+		},
+		{
+			desc:    "not a key",
+			pem:     pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("not a key")}),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := auth.ParsePrivateKey(tt.pem)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePrivateKey() got error %v, want error: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(key) {
+				t.Error("ParsePrivateKey() got a different key")
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vtsao/repon/internal/rewind"
+)
+
+var errNoTokens = errors.New("auth: pool has no tokens")
+
+// budget is what's left of a token's rate limit for a resource.
+type budget struct {
+	remaining int
+	reset     time.Time
+}
+
+// Pool is an http.RoundTripper that authenticates each request with one of
+// several tokens, to spread requests across their rate limits. Each token's
+// remaining rate limit is tracked from GitHub's X-RateLimit-Remaining response
+// header, and requests use the token with the most left. A request rejected
+// because its token ran out is retried right away with another token that has
+// some left. It is safe for concurrent use, so a single Pool can be shared by
+// REST and GraphQL clients.
+type Pool struct {
+	// Base is the transport used to make requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	tokens []string
+
+	mu sync.Mutex
+	// next is the token to start looking from, so tokens with the same budget
+	// take turns.
+	next int
+	// budgets are the known budgets of each token, by rate limit resource and
+	// then token.
+	budgets map[string]map[int]budget
+}
+
+// NewPool returns a Pool of tokens, which makes requests with base.
+func NewPool(tokens []string, base http.RoundTripper) *Pool {
+	return &Pool{Base: base, tokens: tokens, budgets: make(map[string]map[int]budget)}
+}
+
+func (p *Pool) base() http.RoundTripper {
+	if p.Base != nil {
+		return p.Base
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (p *Pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(p.tokens) == 0 {
+		return nil, errNoTokens
+	}
+	res := resource(req)
+	tried := make(map[int]bool)
+	for {
+		i := p.pick(res, tried)
+		tried[i] = true
+		r, err := rewind.Request(req, len(tried)-1)
+		if err != nil {
+			return nil, err
+		}
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "token "+p.tokens[i])
+
+		resp, err := p.base().RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		p.update(res, i, resp)
+		if !exhausted(resp) || len(tried) == len(p.tokens) || !p.hasBudget(res, tried) {
+			return resp, nil
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// pick returns the untried token with the most budget left for the resource.
+// Tokens whose budget isn't known yet, or has since reset, are picked first.
+func (p *Pool) pick(res string, tried map[int]bool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	best, bestRemaining := -1, -1
+	for j := 0; j < len(p.tokens); j++ {
+		i := (p.next + j) % len(p.tokens)
+		if tried[i] {
+			continue
+		}
+		if remaining := p.remaining(res, i); remaining > bestRemaining {
+			best, bestRemaining = i, remaining
+		}
+	}
+	p.next = (best + 1) % len(p.tokens)
+	return best
+}
+
+// remaining returns the token's budget left for the resource. p.mu must be
+// held.
+func (p *Pool) remaining(res string, i int) int {
+	b, ok := p.budgets[res][i]
+	if !ok || time.Now().After(b.reset) {
+		return math.MaxInt32
+	}
+	return b.remaining
+}
+
+// hasBudget returns whether any untried token has budget left for the
+// resource.
+func (p *Pool) hasBudget(res string, tried map[int]bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.tokens {
+		if !tried[i] && p.remaining(res, i) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// update records the token's budget from resp's rate limit headers.
+func (p *Pool) update(res string, i int, resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.budgets[res] == nil {
+		p.budgets[res] = make(map[int]budget)
+	}
+	p.budgets[res][i] = budget{remaining: remaining, reset: time.Unix(reset, 0)}
+}
+
+// resource returns the rate limit resource a request counts against. Search
+// and GraphQL have their own rate limits, separate from the rest of the REST
+// API.
+func resource(req *http.Request) string {
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/graphql"):
+		return "graphql"
+	case strings.Contains(req.URL.Path, "/search/"):
+		return "search"
+	}
+	return "core"
+}
+
+// exhausted returns whether resp was rejected because its token has no rate
+// limit left.
+func exhausted(resp *http.Response) bool {
+	return (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) &&
+		resp.Header.Get("X-RateLimit-Remaining") == "0"
+}
@@ -0,0 +1,135 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/auth"
+)
+
+// budgetServ creates a server where each token has a budget of requests for
+// each path, after which requests are rate limited. It also records the token
+// used for every request.
+func budgetServ(t *testing.T, budgets map[string]int) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var used []string
+	remaining := make(map[string]int)
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "token ")
+		key := r.URL.Path + " " + token
+
+		mu.Lock()
+		used = append(used, token)
+		left, ok := remaining[key]
+		if !ok {
+			left = budgets[token]
+		}
+		limited := left == 0
+		if !limited {
+			left--
+		}
+		remaining[key] = left
+		mu.Unlock()
+
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(left))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		if limited {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	return serv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), used...)
+	}
+}
+
+func TestPool(t *testing.T) {
+	tests := []struct {
+		desc       string
+		budgets    map[string]int
+		paths      []string
+		wantUsed   []string
+		wantStatus []int
+	}{
+		{
+			desc:    "prefers most budget",
+			budgets: map[string]int{"a": 10, "b": 100, "c": 50},
+			paths:   []string{"/repos", "/repos", "/repos", "/repos", "/repos"},
+			// Every token is tried once to learn its budget.
+			wantUsed:   []string{"a", "b", "c", "b", "b"},
+			wantStatus: []int{200, 200, 200, 200, 200},
+		},
+		{
+			desc:       "retries exhausted token with another",
+			budgets:    map[string]int{"a": 0, "b": 10},
+			paths:      []string{"/repos", "/repos"},
+			wantUsed:   []string{"a", "b", "b"},
+			wantStatus: []int{200, 200},
+		},
+		{
+			desc:       "every token exhausted",
+			budgets:    map[string]int{"a": 0, "b": 0},
+			paths:      []string{"/repos", "/repos"},
+			wantUsed:   []string{"a", "b", "a"},
+			wantStatus: []int{403, 403},
+		},
+		{
+			desc:    "budgets by resource",
+			budgets: map[string]int{"a": 10, "b": 100},
+			paths:   []string{"/repos", "/repos", "/search/repositories", "/search/repositories", "/repos"},
+			// Search has its own budget, so both tokens are tried again for it.
+			wantUsed:   []string{"a", "b", "a", "b", "b"},
+			wantStatus: []int{200, 200, 200, 200, 200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			serv, used := budgetServ(t, tt.budgets)
+			defer serv.Close()
+			var tokens []string
+			for token := range tt.budgets {
+				tokens = append(tokens, token)
+			}
+			sort.Strings(tokens)
+			client := &http.Client{Transport: auth.NewPool(tokens, nil)}
+
+			var statuses []int
+			for _, path := range tt.paths {
+				resp, err := client.Get(serv.URL + path)
+				if err != nil {
+					t.Fatalf("Get(%q) failed: %v", path, err)
+				}
+				resp.Body.Close()
+				statuses = append(statuses, resp.StatusCode)
+			}
+
+			if diff := cmp.Diff(tt.wantStatus, statuses); diff != "" {
+				t.Errorf("Get() got statuses diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantUsed, used()); diff != "" {
+				t.Errorf("Get() used tokens diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPoolNoTokens(t *testing.T) {
+	serv, _ := budgetServ(t, nil)
+	defer serv.Close()
+	client := &http.Client{Transport: auth.NewPool(nil, nil)}
+	if resp, err := client.Get(serv.URL + "/repos"); err == nil {
+		resp.Body.Close()
+		t.Errorf("Get() succeeded, want error for a pool without tokens")
+	}
+}
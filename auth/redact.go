@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// redacted replaces secrets in output.
+const redacted = "[REDACTED]"
+
+// Redactor is an io.Writer that replaces secrets, such as tokens, in what's
+// written to it. Use it as the log output so tokens never show up in logs or
+// logged errors. It is safe for concurrent use.
+type Redactor struct {
+	w io.Writer
+
+	mu      sync.Mutex
+	secrets []string
+}
+
+// NewRedactor returns a Redactor that writes to w.
+func NewRedactor(w io.Writer) *Redactor {
+	return &Redactor{w: w}
+}
+
+// Add adds a secret to redact.
+func (r *Redactor) Add(secret string) {
+	if secret == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.secrets {
+		if s == secret {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, secret)
+}
+
+// Redact returns s with every secret replaced.
+func (r *Redactor) Redact(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// Write implements io.Writer. Secrets split across writes aren't redacted, but
+// the log package writes each message at once.
+func (r *Redactor) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, r.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// TokenSource returns a token source that adds every token from src as a
+// secret, for tokens that change over time such as installation tokens.
+func (r *Redactor) TokenSource(src oauth2.TokenSource) oauth2.TokenSource {
+	return &redactingSource{r: r, src: src}
+}
+
+type redactingSource struct {
+	r   *Redactor
+	src oauth2.TokenSource
+}
+
+func (s *redactingSource) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.r.Add(token.AccessToken)
+	return token, nil
+}
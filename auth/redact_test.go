@@ -0,0 +1,32 @@
+package auth_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"testing"
+
+	"github.com/vtsao/repon/auth"
+	"golang.org/x/oauth2"
+)
+
+func TestRedactor(t *testing.T) {
+	var buf bytes.Buffer
+	r := auth.NewRedactor(&buf)
+	r.Add("ghp_secret")
+	r.Add("")
+
+	// Tokens from a token source are redacted once they're used.
+	src := r.TokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "ghs_installation"}))
+	if _, err := src.Token(); err != nil {
+		t.Fatalf("Token() failed: %v", err)
+	}
+
+	logger := log.New(r, "", 0)
+	logger.Printf("Error: %v", fmt.Errorf("bad credentials for ghp_secret and ghs_installation"))
+
+	want := "Error: bad credentials for [REDACTED] and [REDACTED]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Redactor wrote %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultHost is the host of github.com in the gh CLI's config.
+const defaultHost = "github.com"
+
+// tokenEnvVars are the environment variables a token is read from, in order of
+// precedence. GH_TOKEN takes precedence like it does for the gh CLI.
+var tokenEnvVars = []string{"GH_TOKEN", "GITHUB_TOKEN"}
+
+// ErrNoToken is returned by Token.Resolve when no token is found.
+var ErrNoToken = errors.New("no GitHub token found, set --pat_file, GH_TOKEN or GITHUB_TOKEN, or log in with `gh auth login`")
+
+// Token resolves personal access tokens from the first place they're found,
+// in order:
+//
+//  1. PAT, from --pat.
+//  2. PATFile, from --pat_file.
+//  3. The GH_TOKEN environment variable.
+//  4. The GITHUB_TOKEN environment variable.
+//  5. The gh CLI's hosts.yml for Host.
+//
+// Multiple tokens can be given to spread requests across their rate limits,
+// see Pool. They're comma separated in PAT and the environment variables, and
+// one per line in PATFile.
+type Token struct {
+	// PAT is the comma separated tokens themselves.
+	PAT string
+	// PATFile is a file containing the tokens.
+	PATFile string
+	// Host is the GitHub host to find the gh CLI's token for. If empty,
+	// github.com is used.
+	Host string
+	// Getenv looks up environment variables. If nil, os.Getenv is used.
+	Getenv func(key string) string
+	// GHConfigDir is the gh CLI's config directory. If empty, it's found the same
+	// way the gh CLI finds it.
+	GHConfigDir string
+}
+
+// Resolve returns the tokens and a description of where they were found, such
+// as "GH_TOKEN". ErrNoToken is returned if there's no token anywhere.
+func (t *Token) Resolve() (tokens []string, source string, err error) {
+	if t.PAT != "" {
+		tokens := splitTokens(t.PAT, ",")
+		if len(tokens) == 0 {
+			return nil, "", errors.New("--pat has no tokens")
+		}
+		return tokens, "--pat", nil
+	}
+	if t.PATFile != "" {
+		b, err := ioutil.ReadFile(t.PATFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading PAT file: %v", err)
+		}
+		tokens := splitTokens(string(b), "\n")
+		if len(tokens) == 0 {
+			return nil, "", fmt.Errorf("PAT file %q is empty", t.PATFile)
+		}
+		return tokens, "--pat_file", nil
+	}
+	for _, key := range tokenEnvVars {
+		if tokens := splitTokens(t.getenv(key), ","); len(tokens) > 0 {
+			return tokens, key, nil
+		}
+	}
+
+	path := filepath.Join(t.ghConfigDir(), "hosts.yml")
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, "", ErrNoToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	host := t.Host
+	if host == "" {
+		host = defaultHost
+	}
+	token, err := readGHToken(f, host)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading %s: %v", path, err)
+	}
+	if token == "" {
+		return nil, "", ErrNoToken
+	}
+	return []string{token}, path, nil
+}
+
+// splitTokens splits s into tokens separated by sep, ignoring blanks.
+func splitTokens(s, sep string) []string {
+	var tokens []string
+	for _, token := range strings.Split(s, sep) {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func (t *Token) getenv(key string) string {
+	if t.Getenv != nil {
+		return t.Getenv(key)
+	}
+	return os.Getenv(key)
+}
+
+// ghConfigDir returns the gh CLI's config directory.
+func (t *Token) ghConfigDir() string {
+	if t.GHConfigDir != "" {
+		return t.GHConfigDir
+	}
+	if dir := t.getenv("GH_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if dir := t.getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "gh")
+}
+
+// readGHToken returns the oauth_token for host from the gh CLI's hosts.yml,
+// which looks like:
+//
+//	github.com:
+//	    user: octocat
+//	    oauth_token: gho_xxxx
+//	    git_protocol: https
+//
+// Only this simple shape of YAML is supported. Newer versions of the gh CLI
+// keep the token in the system keyring instead, in which case "" is returned.
+func readGHToken(r io.Reader, host string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	inHost := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		// Hosts are the top level keys.
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			inHost = unquote(strings.TrimSuffix(trimmed, ":")) == host
+			continue
+		}
+		if !inHost {
+			continue
+		}
+		parts := strings.SplitN(trimmed, ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == "oauth_token" {
+			return unquote(strings.TrimSpace(parts[1])), nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// unquote removes YAML quotes from s, if any.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,131 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/auth"
+)
+
+const hostsYML = `github.com:
+    user: octocat
+    oauth_token: gho_dotcom
+    git_protocol: https
+"github.example.com":
+    user: octocat
+    oauth_token: 'gho_enterprise'
+keyring.example.com:
+    user: octocat
+`
+
+func TestTokenResolve(t *testing.T) {
+	dir := t.TempDir()
+	patFile := filepath.Join(dir, "pat")
+	if err := ioutil.WriteFile(patFile, []byte("ghp_file1\n\nghp_file2\n"), 0600); err != nil {
+		t.Fatalf("WriteFile(%q) failed: %v", patFile, err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := ioutil.WriteFile(emptyFile, nil, 0600); err != nil {
+		t.Fatalf("WriteFile(%q) failed: %v", emptyFile, err)
+	}
+	ghDir := filepath.Join(dir, "gh")
+	if err := ioutil.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(hostsYML), 0600); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	env := map[string]string{"GH_TOKEN": "ghp_gh1, ghp_gh2", "GITHUB_TOKEN": "ghp_github"}
+
+	tests := []struct {
+		desc       string
+		token      auth.Token
+		env        map[string]string
+		want       []string
+		wantSource string
+		wantErr    bool
+		// wantNoToken is whether ErrNoToken is returned.
+		wantNoToken bool
+	}{
+		{
+			desc:       "--pat first",
+			token:      auth.Token{PAT: "ghp_flag", PATFile: patFile, GHConfigDir: dir},
+			env:        env,
+			want:       []string{"ghp_flag"},
+			wantSource: "--pat",
+		},
+		{
+			desc:       "--pat_file before environment",
+			token:      auth.Token{PATFile: patFile, GHConfigDir: dir},
+			env:        env,
+			want:       []string{"ghp_file1", "ghp_file2"},
+			wantSource: "--pat_file",
+		},
+		{
+			desc:       "GH_TOKEN before GITHUB_TOKEN",
+			token:      auth.Token{GHConfigDir: dir},
+			env:        env,
+			want:       []string{"ghp_gh1", "ghp_gh2"},
+			wantSource: "GH_TOKEN",
+		},
+		{
+			desc:       "GITHUB_TOKEN",
+			token:      auth.Token{GHConfigDir: dir},
+			env:        map[string]string{"GITHUB_TOKEN": "ghp_github"},
+			want:       []string{"ghp_github"},
+			wantSource: "GITHUB_TOKEN",
+		},
+		{
+			desc:       "gh hosts.yml",
+			token:      auth.Token{GHConfigDir: dir},
+			want:       []string{"gho_dotcom"},
+			wantSource: filepath.Join(dir, "hosts.yml"),
+		},
+		{
+			desc:       "gh hosts.yml for enterprise host",
+			token:      auth.Token{Host: "github.example.com", GHConfigDir: dir},
+			want:       []string{"gho_enterprise"},
+			wantSource: filepath.Join(dir, "hosts.yml"),
+		},
+		{
+			desc:        "gh token in keyring",
+			token:       auth.Token{Host: "keyring.example.com", GHConfigDir: dir},
+			wantNoToken: true,
+		},
+		{
+			desc:        "no gh config",
+			token:       auth.Token{GHConfigDir: ghDir},
+			wantNoToken: true,
+		},
+		{
+			desc:    "--pat without tokens",
+			token:   auth.Token{PAT: " , ", PATFile: patFile, GHConfigDir: dir},
+			env:     env,
+			wantErr: true,
+		},
+		{
+			desc:    "empty --pat_file",
+			token:   auth.Token{PATFile: emptyFile, GHConfigDir: dir},
+			env:     env,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			tt.token.Getenv = func(key string) string { return tt.env[key] }
+			got, source, err := tt.token.Resolve()
+			if (err != nil) != (tt.wantErr || tt.wantNoToken) {
+				t.Fatalf("Resolve() got error %v, want error: %v", err, tt.wantErr || tt.wantNoToken)
+			}
+			if tt.wantNoToken && err != auth.ErrNoToken {
+				t.Errorf("Resolve() got error %v, want %v", err, auth.ErrNoToken)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Resolve() got tokens diff (-want +got):\n%s", diff)
+			}
+			if source != tt.wantSource {
+				t.Errorf("Resolve() got source %q, want %q", source, tt.wantSource)
+			}
+		})
+	}
+}
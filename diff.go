@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vtsao/repon/store"
+	"github.com/vtsao/repon/topn"
+)
+
+// diffMain runs "repon diff", which compares two snapshots of an owner's
+// ranked repos from --store.
+func diffMain(args []string) {
+	fs := flag.NewFlagSet("repon diff", flag.ExitOnError)
+	storeDir := fs.String("store", "", "required, directory of snapshots stored by repon --store")
+	owner := fs.String("owner", "", "required, organization or user whose snapshots to compare")
+	metric := fs.String("metric", "", "only compare snapshots ranked by this metric, defaults to that of the newest snapshot")
+	from := fs.String("from", "", "compare the last snapshot at or before this date (2006-01-02) or RFC 3339 time, defaults to the one before --to")
+	to := fs.String("to", "", "compare with the last snapshot at or before this date (2006-01-02) or RFC 3339 time, defaults to the newest")
+	output := fs.String("output", "text", `the format to output the diff in, must be "text" or "json"`)
+	fs.Parse(args)
+
+	if *storeDir == "" || *owner == "" {
+		fs.PrintDefaults()
+		log.Fatal("--store and --owner are required")
+	}
+	if *output != "text" && *output != "json" {
+		fs.PrintDefaults()
+		log.Fatal(`--output must be "text" or "json"`)
+	}
+	parse := func(name, s string) time.Time {
+		if s == "" {
+			return time.Time{}
+		}
+		t, err := parseTime(s)
+		if err != nil {
+			log.Fatalf("--%s must be a date (2006-01-02) or RFC 3339 time: %v", name, err)
+		}
+		// A date includes the whole day.
+		if !strings.Contains(s, "T") {
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		return t
+	}
+	fromTime, toTime := parse("from", *from), parse("to", *to)
+
+	s := &store.Store{Dir: *storeDir}
+	snaps, err := s.Snapshots(*owner)
+	if err != nil {
+		log.Fatalf("Error reading snapshots of %q: %v", *owner, err)
+	}
+	old, new, err := store.Pair(snaps, *metric, fromTime, toTime)
+	if err != nil {
+		log.Fatalf("Error picking snapshots of %q to compare: %v", *owner, err)
+	}
+	d, err := store.Compare(old, new)
+	if err != nil {
+		log.Fatalf("Error comparing snapshots of %q: %v", *owner, err)
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(d)
+	} else {
+		err = writeDiff(os.Stdout, d)
+	}
+	if err != nil {
+		log.Fatalf("Error writing diff: %v", err)
+	}
+}
+
+// writeDiff writes a human readable line per repo in the diff, with its rank
+// movement and the change in each metric.
+func writeDiff(w io.Writer, d *store.Diff) error {
+	if _, err := fmt.Fprintf(w, "Changes to repos for %q by %q from %s to %s:\n", d.Owner, d.Metric, d.From.Format(time.RFC3339), d.To.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	for _, r := range d.Repos {
+		var line string
+		switch {
+		case r.Left():
+			line = fmt.Sprintf("-) repo: %q left, was %d", r.Name, r.OldRank)
+		case r.Entered():
+			line = fmt.Sprintf("%d) repo: %q new", r.NewRank, r.Name)
+		default:
+			line = fmt.Sprintf("%d) repo: %q %s", r.NewRank, r.Name, movement(r.Moved()))
+		}
+		for _, delta := range r.Deltas {
+			line += ", " + formatDelta(delta)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// movement describes how many ranks a repo moved, e.g. "▲3" or "▼2".
+func movement(moved int) string {
+	switch {
+	case moved > 0:
+		return fmt.Sprintf("▲%d", moved)
+	case moved < 0:
+		return fmt.Sprintf("▼%d", -moved)
+	}
+	return "="
+}
+
+// formatDelta formats the change in a metric for humans, e.g.
+// "stars: 210 (+10, +5.00%)".
+func formatDelta(d store.Delta) string {
+	desc, format := d.Metric, func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	if m, ok := topn.LookupMetric(d.Metric); ok {
+		desc, format = m.Desc, m.FormatValue
+	}
+	sign := "+"
+	if d.Change < 0 {
+		sign = ""
+	}
+	s := fmt.Sprintf("%s: %s (%s%s", desc, format(d.New), sign, format(d.Change))
+	if d.Percent != nil {
+		s += fmt.Sprintf(", %s%.2f%%", sign, *d.Percent)
+	}
+	return s + ")"
+}
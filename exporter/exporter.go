@@ -0,0 +1,222 @@
+// Package exporter exports the metrics of GitHub organizations' repos to
+// Prometheus, refreshing them periodically rather than on every scrape so
+// scrapes don't spend GitHub API rate limit.
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vtsao/repon/repoql"
+	"github.com/vtsao/repon/topn"
+)
+
+// contentType is that of the Prometheus text exposition format. See
+// https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Lister lists an owner's top-n repos by metric along with the GraphQL API rate
+// limit points spent, as repoql.TopN does.
+type Lister interface {
+	ListWithStats(ctx context.Context, org string, n int, metric string) ([]*topn.Repo, repoql.Stats, error)
+}
+
+// Exporter is an http.Handler that serves the metrics of every repo of Owners
+// in the Prometheus text format, as of the last Refresh:
+//
+//	repon_repo_stars{org="netflix",repo="Hystrix"} 21700
+//
+// Users' repos are exported the same way, with the user's login as the org
+// label.
+type Exporter struct {
+	Lister Lister
+	// Owners are the logins of the organizations and users whose repos are
+	// exported.
+	Owners []string
+
+	mu     sync.Mutex
+	owners map[string]*owner
+	// remaining is the GraphQL API rate limit points remaining until resetAt,
+	// as of the last query. resetAt is zero if there hasn't been one yet.
+	remaining int
+	resetAt   time.Time
+}
+
+// owner is an owner's repos as of the last refresh that listed them.
+type owner struct {
+	repos []*topn.Repo
+	// duration is how long the last refresh of the owner took.
+	duration time.Duration
+	// success is whether the last refresh succeeded. If it failed, repos are
+	// those of the last one that succeeded.
+	success bool
+}
+
+// Refresh lists the repos of every owner, keeping the previous repos of any
+// owner whose repos can't be listed. It returns the first error listing repos.
+func (e *Exporter) Refresh(ctx context.Context) error {
+	var firstErr error
+	for _, login := range e.Owners {
+		start := time.Now()
+		repos, stats, err := e.Lister.ListWithStats(ctx, login, math.MaxInt32, "stars")
+		duration := time.Since(start)
+
+		e.mu.Lock()
+		if e.owners == nil {
+			e.owners = make(map[string]*owner)
+		}
+		o, ok := e.owners[login]
+		if !ok {
+			o = &owner{}
+			e.owners[login] = o
+		}
+		o.duration, o.success = duration, err == nil
+		if err == nil {
+			o.repos = repos
+		}
+		if stats.Queries > 0 && !stats.ResetAt.Before(e.resetAt) {
+			e.remaining, e.resetAt = stats.Remaining, stats.ResetAt
+		}
+		e.mu.Unlock()
+
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("listing repos for %q: %v", login, err)
+		}
+	}
+	return firstErr
+}
+
+// Run refreshes the repos right away and then every interval, until ctx is
+// done. Errors are logged, and the previous repos are exported until a refresh
+// succeeds.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		if err := e.Refresh(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error refreshing repos: %v", err)
+		} else {
+			log.Printf("Refreshed repos for %q in %s", e.Owners, time.Since(start))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// gauge is a Prometheus gauge and its samples.
+type gauge struct {
+	name    string
+	help    string
+	samples []sample
+}
+
+type sample struct {
+	// labels are label name and value pairs.
+	labels []string
+	value  float64
+}
+
+// gauges returns the gauges to export, with samples in the order of Owners and
+// each owner's repos sorted by name.
+func (e *Exporter) gauges() []*gauge {
+	stars := &gauge{name: "repon_repo_stars", help: "Number of stars of the repo."}
+	forks := &gauge{name: "repon_repo_forks", help: "Number of forks of the repo."}
+	prs := &gauge{name: "repon_repo_pull_requests", help: "Number of pull requests of the repo, in any state."}
+	duration := &gauge{name: "repon_scrape_duration_seconds", help: "How long the last refresh of the org's repos took."}
+	success := &gauge{name: "repon_scrape_success", help: "Whether the last refresh of the org's repos succeeded."}
+	remaining := &gauge{name: "repon_github_rate_limit_remaining", help: "GitHub GraphQL API rate limit points remaining as of the last refresh."}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, login := range e.Owners {
+		o, ok := e.owners[login]
+		if !ok {
+			continue
+		}
+		repos := append([]*topn.Repo(nil), o.repos...)
+		sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+		for _, r := range repos {
+			labels := []string{"org", login, "repo", r.Name}
+			stars.samples = append(stars.samples, sample{labels: labels, value: float64(r.Stars)})
+			forks.samples = append(forks.samples, sample{labels: labels, value: float64(r.Forks)})
+			prs.samples = append(prs.samples, sample{labels: labels, value: float64(r.PRs)})
+		}
+
+		labels := []string{"org", login}
+		duration.samples = append(duration.samples, sample{labels: labels, value: o.duration.Seconds()})
+		value := 0.0
+		if o.success {
+			value = 1
+		}
+		success.samples = append(success.samples, sample{labels: labels, value: value})
+	}
+	if !e.resetAt.IsZero() {
+		remaining.samples = append(remaining.samples, sample{value: float64(e.remaining)})
+	}
+	return []*gauge{stars, forks, prs, duration, success, remaining}
+}
+
+// ServeHTTP implements http.Handler.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	if err := write(w, e.gauges()); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
+
+// write writes the gauges in the Prometheus text format, leaving out gauges
+// without samples.
+func write(w io.Writer, gauges []*gauge) error {
+	for _, g := range gauges {
+		if len(g.samples) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name); err != nil {
+			return err
+		}
+		for _, s := range g.samples {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(s.labels), strconv.FormatFloat(s.value, 'g', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// labelEscaper escapes label values, which are quoted.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats label name and value pairs as {name="value",...}, or
+// nothing if there are none.
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	b.WriteString("}")
+	return b.String()
+}
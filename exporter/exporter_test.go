@@ -0,0 +1,232 @@
+package exporter_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/exporter"
+	"github.com/vtsao/repon/repoql"
+	"github.com/vtsao/repon/topn"
+)
+
+var resetAt = time.Date(2020, 12, 21, 10, 0, 0, 0, time.UTC)
+
+// fakeLister lists the repos of each owner in order of refreshes, where a nil
+// refresh fails. Each query leaves one less rate limit point.
+type fakeLister struct {
+	refreshes map[string][][]*topn.Repo
+	remaining int
+}
+
+func (l *fakeLister) ListWithStats(ctx context.Context, org string, n int, metric string) ([]*topn.Repo, repoql.Stats, error) {
+	if metric != "stars" {
+		return nil, repoql.Stats{}, errors.New("unexpected metric " + metric)
+	}
+	l.remaining--
+	stats := repoql.Stats{Queries: 1, Cost: 1, Remaining: l.remaining, ResetAt: resetAt}
+
+	refreshes := l.refreshes[org]
+	if len(refreshes) == 0 {
+		return nil, stats, errors.New("no more refreshes")
+	}
+	repos := refreshes[0]
+	l.refreshes[org] = refreshes[1:]
+	if repos == nil {
+		return nil, stats, errors.New("GitHub is down")
+	}
+	return repos, stats, nil
+}
+
+// durations matches the values of scrape durations, which vary.
+var durations = regexp.MustCompile(`(?m)^(repon_scrape_duration_seconds\{.*\}) .*$`)
+
+func TestExporter(t *testing.T) {
+	tests := []struct {
+		desc      string
+		owners    []string
+		refreshes map[string][][]*topn.Repo
+		// numRefreshes is the number of times to refresh before scraping.
+		numRefreshes int
+		wantErr      bool
+		want         string
+	}{
+		{
+			desc:         "not refreshed",
+			owners:       []string{"netflix"},
+			numRefreshes: 0,
+			want:         "",
+		},
+		{
+			desc:   "orgs",
+			owners: []string{"netflix", "google"},
+			refreshes: map[string][][]*topn.Repo{
+				"netflix": {{
+					{Name: "zuul", Stars: 10800, Forks: 2100, PRs: 569},
+					{Name: "Hystrix", Stars: 21700, Forks: 4400, PRs: 1039},
+				}},
+				"google": {{
+					{Name: "guava", Stars: 41000, Forks: 9300, PRs: 1000},
+				}},
+			},
+			numRefreshes: 1,
+			want: `# HELP repon_repo_stars Number of stars of the repo.
+# TYPE repon_repo_stars gauge
+repon_repo_stars{org="netflix",repo="Hystrix"} 21700
+repon_repo_stars{org="netflix",repo="zuul"} 10800
+repon_repo_stars{org="google",repo="guava"} 41000
+# HELP repon_repo_forks Number of forks of the repo.
+# TYPE repon_repo_forks gauge
+repon_repo_forks{org="netflix",repo="Hystrix"} 4400
+repon_repo_forks{org="netflix",repo="zuul"} 2100
+repon_repo_forks{org="google",repo="guava"} 9300
+# HELP repon_repo_pull_requests Number of pull requests of the repo, in any state.
+# TYPE repon_repo_pull_requests gauge
+repon_repo_pull_requests{org="netflix",repo="Hystrix"} 1039
+repon_repo_pull_requests{org="netflix",repo="zuul"} 569
+repon_repo_pull_requests{org="google",repo="guava"} 1000
+# HELP repon_scrape_duration_seconds How long the last refresh of the org's repos took.
+# TYPE repon_scrape_duration_seconds gauge
+repon_scrape_duration_seconds{org="netflix"} 0
+repon_scrape_duration_seconds{org="google"} 0
+# HELP repon_scrape_success Whether the last refresh of the org's repos succeeded.
+# TYPE repon_scrape_success gauge
+repon_scrape_success{org="netflix"} 1
+repon_scrape_success{org="google"} 1
+# HELP repon_github_rate_limit_remaining GitHub GraphQL API rate limit points remaining as of the last refresh.
+# TYPE repon_github_rate_limit_remaining gauge
+repon_github_rate_limit_remaining 4998
+`,
+		},
+		{
+			desc:   "refreshed",
+			owners: []string{"netflix"},
+			refreshes: map[string][][]*topn.Repo{
+				"netflix": {
+					{{Name: "Hystrix", Stars: 21700, Forks: 4400, PRs: 1039}},
+					{{Name: "Hystrix", Stars: 21710, Forks: 4401, PRs: 1040}},
+				},
+			},
+			numRefreshes: 2,
+			want: `# HELP repon_repo_stars Number of stars of the repo.
+# TYPE repon_repo_stars gauge
+repon_repo_stars{org="netflix",repo="Hystrix"} 21710
+# HELP repon_repo_forks Number of forks of the repo.
+# TYPE repon_repo_forks gauge
+repon_repo_forks{org="netflix",repo="Hystrix"} 4401
+# HELP repon_repo_pull_requests Number of pull requests of the repo, in any state.
+# TYPE repon_repo_pull_requests gauge
+repon_repo_pull_requests{org="netflix",repo="Hystrix"} 1040
+# HELP repon_scrape_duration_seconds How long the last refresh of the org's repos took.
+# TYPE repon_scrape_duration_seconds gauge
+repon_scrape_duration_seconds{org="netflix"} 0
+# HELP repon_scrape_success Whether the last refresh of the org's repos succeeded.
+# TYPE repon_scrape_success gauge
+repon_scrape_success{org="netflix"} 1
+# HELP repon_github_rate_limit_remaining GitHub GraphQL API rate limit points remaining as of the last refresh.
+# TYPE repon_github_rate_limit_remaining gauge
+repon_github_rate_limit_remaining 4998
+`,
+		},
+		{
+			desc:   "failed refresh keeps repos",
+			owners: []string{"netflix"},
+			refreshes: map[string][][]*topn.Repo{
+				"netflix": {
+					{{Name: "Hystrix", Stars: 21700, Forks: 4400, PRs: 1039}},
+					nil,
+				},
+			},
+			numRefreshes: 2,
+			wantErr:      true,
+			want: `# HELP repon_repo_stars Number of stars of the repo.
+# TYPE repon_repo_stars gauge
+repon_repo_stars{org="netflix",repo="Hystrix"} 21700
+# HELP repon_repo_forks Number of forks of the repo.
+# TYPE repon_repo_forks gauge
+repon_repo_forks{org="netflix",repo="Hystrix"} 4400
+# HELP repon_repo_pull_requests Number of pull requests of the repo, in any state.
+# TYPE repon_repo_pull_requests gauge
+repon_repo_pull_requests{org="netflix",repo="Hystrix"} 1039
+# HELP repon_scrape_duration_seconds How long the last refresh of the org's repos took.
+# TYPE repon_scrape_duration_seconds gauge
+repon_scrape_duration_seconds{org="netflix"} 0
+# HELP repon_scrape_success Whether the last refresh of the org's repos succeeded.
+# TYPE repon_scrape_success gauge
+repon_scrape_success{org="netflix"} 0
+# HELP repon_github_rate_limit_remaining GitHub GraphQL API rate limit points remaining as of the last refresh.
+# TYPE repon_github_rate_limit_remaining gauge
+repon_github_rate_limit_remaining 4998
+`,
+		},
+		{
+			desc:   "escapes labels",
+			owners: []string{"netflix"},
+			refreshes: map[string][][]*topn.Repo{
+				"netflix": {{{Name: `a"b\c`, Stars: 1}}},
+			},
+			numRefreshes: 1,
+			want: `# HELP repon_repo_stars Number of stars of the repo.
+# TYPE repon_repo_stars gauge
+repon_repo_stars{org="netflix",repo="a\"b\\c"} 1
+# HELP repon_repo_forks Number of forks of the repo.
+# TYPE repon_repo_forks gauge
+repon_repo_forks{org="netflix",repo="a\"b\\c"} 0
+# HELP repon_repo_pull_requests Number of pull requests of the repo, in any state.
+# TYPE repon_repo_pull_requests gauge
+repon_repo_pull_requests{org="netflix",repo="a\"b\\c"} 0
+# HELP repon_scrape_duration_seconds How long the last refresh of the org's repos took.
+# TYPE repon_scrape_duration_seconds gauge
+repon_scrape_duration_seconds{org="netflix"} 0
+# HELP repon_scrape_success Whether the last refresh of the org's repos succeeded.
+# TYPE repon_scrape_success gauge
+repon_scrape_success{org="netflix"} 1
+# HELP repon_github_rate_limit_remaining GitHub GraphQL API rate limit points remaining as of the last refresh.
+# TYPE repon_github_rate_limit_remaining gauge
+repon_github_rate_limit_remaining 4999
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			e := &exporter.Exporter{
+				Lister: &fakeLister{refreshes: tt.refreshes, remaining: 5000},
+				Owners: tt.owners,
+			}
+			var err error
+			for i := 0; i < tt.numRefreshes; i++ {
+				err = e.Refresh(context.Background())
+			}
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("Refresh() got err %v, want err %t", err, tt.wantErr)
+			}
+
+			serv := httptest.NewServer(e)
+			defer serv.Close()
+			resp, err := http.Get(serv.URL + "/metrics")
+			if err != nil {
+				t.Fatalf("Get() failed: %v", err)
+			}
+			defer resp.Body.Close()
+			if got, want := resp.Header.Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8"; got != want {
+				t.Errorf("Get() got Content-Type %q, want %q", got, want)
+			}
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Reading body failed: %v", err)
+			}
+
+			got := durations.ReplaceAllString(string(b), "$1 0")
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Get() got metrics diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
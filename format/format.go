@@ -0,0 +1,332 @@
+// Package format writes the top-n repos returned by a topn.Backend in human
+// readable and machine readable formats.
+package format
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vtsao/repon/topn"
+)
+
+type writeFunc func(w io.Writer, repos []*topn.Repo, metric string, measured measuredSet) error
+
+// measuredSet is the set of metrics that were measured for the repos. Formats
+// leave out, or leave blank, the values of every other metric, which the
+// backend didn't fill in.
+type measuredSet map[string]bool
+
+func newMeasuredSet(measured []string) measuredSet {
+	set := make(measuredSet)
+	for _, m := range measured {
+		set[m] = true
+	}
+	return set
+}
+
+// intValue returns v if the metric was measured, or nil if it wasn't.
+func (s measuredSet) intValue(metric string, v int) *int {
+	if !s[metric] {
+		return nil
+	}
+	return &v
+}
+
+// metrics returns the additional metrics that were measured.
+func (s measuredSet) metrics(metrics map[string]float64) map[string]float64 {
+	var measured map[string]float64
+	for name, v := range metrics {
+		if !s[name] {
+			continue
+		}
+		if measured == nil {
+			measured = make(map[string]float64)
+		}
+		measured[name] = v
+	}
+	return measured
+}
+
+var formats = map[string]writeFunc{
+	"text":     writeText,
+	"json":     writeJSON,
+	"csv":      writeDelimited(',', false),
+	"tsv":      writeDelimited('\t', false),
+	"markdown": writeMarkdown,
+}
+
+// sectionFormats write repos in a section per owner, ranking repos within each
+// owner.
+var sectionFormats = map[string]writeFunc{
+	"text":     writeSections(writeText, "%s:\n"),
+	"json":     writeJSONSections,
+	"csv":      writeDelimited(',', true),
+	"tsv":      writeDelimited('\t', true),
+	"markdown": writeSections(writeMarkdown, "## %s\n\n"),
+}
+
+// Formats returns the names of the supported formats in sorted order.
+func Formats() []string {
+	var names []string
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Supported returns whether the format is supported.
+func Supported(format string) bool {
+	_, ok := formats[format]
+	return ok
+}
+
+// Write writes the repos, which are ranked by metric, to w in the format. Only
+// the measured metrics are written, see topn.Backend.Measured. Other metrics
+// are left out of JSON and blank in tables.
+func Write(w io.Writer, format string, repos []*topn.Repo, metric string, measured []string) error {
+	write, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, must be one of %q", format, Formats())
+	}
+	return write(w, repos, metric, newMeasuredSet(measured))
+}
+
+// WriteSections writes the repos in a section per owner, in the order the owners
+// first appear in repos, to w in the format. Each owner's repos are ranked by
+// metric separately. Only the measured metrics are written, like Write.
+func WriteSections(w io.Writer, format string, repos []*topn.Repo, metric string, measured []string) error {
+	write, ok := sectionFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, must be one of %q", format, Formats())
+	}
+	return write(w, repos, metric, newMeasuredSet(measured))
+}
+
+// section is an owner's repos.
+type section struct {
+	owner string
+	repos []*topn.Repo
+}
+
+// sections splits repos into a section per owner, in the order the owners first
+// appear in repos.
+func sections(repos []*topn.Repo) []*section {
+	var secs []*section
+	byOwner := make(map[string]*section)
+	for _, r := range repos {
+		sec, ok := byOwner[r.Owner]
+		if !ok {
+			sec = &section{owner: r.Owner}
+			byOwner[r.Owner] = sec
+			secs = append(secs, sec)
+		}
+		sec.repos = append(sec.repos, r)
+	}
+	return secs
+}
+
+// writeSections returns a writeFunc that writes each section with write,
+// preceded by a header formatted with the owner and separated by blank lines.
+func writeSections(write writeFunc, header string) writeFunc {
+	return func(w io.Writer, repos []*topn.Repo, metric string, measured measuredSet) error {
+		for i, sec := range sections(repos) {
+			if i > 0 {
+				if _, err := io.WriteString(w, "\n"); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, header, sec.owner); err != nil {
+				return err
+			}
+			if err := write(w, sec.repos, metric, measured); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// fullName returns the repo's name, qualified by its owner if it has one.
+func fullName(r *topn.Repo) string {
+	if r.Owner == "" {
+		return r.Name
+	}
+	return r.Owner + "/" + r.Name
+}
+
+// hasOwners returns whether any of the repos have an owner, in which case
+// formats with columns include an owner column.
+func hasOwners(repos []*topn.Repo) bool {
+	for _, r := range repos {
+		if r.Owner != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeText writes one human readable line per repo with just the metric the
+// repos are ranked by.
+func writeText(w io.Writer, repos []*topn.Repo, metric string, measured measuredSet) error {
+	m, ok := topn.LookupMetric(metric)
+	if !ok {
+		return fmt.Errorf("unknown metric %q", metric)
+	}
+
+	for i, r := range repos {
+		if _, err := fmt.Fprintf(w, "%d) repo: %q, %s: %s\n", i+1, fullName(r), m.Desc, m.Format(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonRepo struct {
+	Rank    int                `json:"rank"`
+	Owner   string             `json:"owner,omitempty"`
+	Name    string             `json:"name"`
+	Stars   *int               `json:"stars,omitempty"`
+	Forks   *int               `json:"forks,omitempty"`
+	PRs     *int               `json:"prs,omitempty"`
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+}
+
+func toJSON(repos []*topn.Repo, measured measuredSet) []jsonRepo {
+	jrs := make([]jsonRepo, 0, len(repos))
+	for i, r := range repos {
+		jrs = append(jrs, jsonRepo{
+			Rank:    i + 1,
+			Owner:   r.Owner,
+			Name:    r.Name,
+			Stars:   measured.intValue("stars", r.Stars),
+			Forks:   measured.intValue("forks", r.Forks),
+			PRs:     measured.intValue("prs", r.PRs),
+			Metrics: measured.metrics(r.Metrics),
+		})
+	}
+	return jrs
+}
+
+func writeJSON(w io.Writer, repos []*topn.Repo, metric string, measured measuredSet) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(toJSON(repos, measured))
+}
+
+type jsonSection struct {
+	Owner string     `json:"owner"`
+	Repos []jsonRepo `json:"repos"`
+}
+
+func writeJSONSections(w io.Writer, repos []*topn.Repo, metric string, measured measuredSet) error {
+	var jss []jsonSection
+	for _, sec := range sections(repos) {
+		jss = append(jss, jsonSection{Owner: sec.owner, Repos: toJSON(sec.repos, measured)})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jss)
+}
+
+// metricNames returns the sorted names of all the measured additional metrics
+// in repos.
+func metricNames(repos []*topn.Repo, measured measuredSet) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, r := range repos {
+		for name := range r.Metrics {
+			if measured[name] && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rows returns a header row followed by one row per repo with every metric,
+// formatting additional metrics with formatFloat. Metrics that weren't
+// measured are blank. Ranks restart for each owner if perOwner is set.
+func rows(repos []*topn.Repo, measured measuredSet, perOwner bool, formatFloat func(float64) string) [][]string {
+	names := metricNames(repos, measured)
+	formatInt := func(metric string, v int) string {
+		if !measured[metric] {
+			return ""
+		}
+		return strconv.Itoa(v)
+	}
+	owners := hasOwners(repos)
+	header := []string{"rank"}
+	if owners {
+		header = append(header, "owner")
+	}
+	header = append(header, "name", "stars", "forks", "prs")
+	table := [][]string{append(header, names...)}
+	rank := 0
+	for i, r := range repos {
+		rank++
+		if perOwner && i > 0 && r.Owner != repos[i-1].Owner {
+			rank = 1
+		}
+		row := []string{strconv.Itoa(rank)}
+		if owners {
+			row = append(row, r.Owner)
+		}
+		row = append(row,
+			r.Name,
+			formatInt("stars", r.Stars),
+			formatInt("forks", r.Forks),
+			formatInt("prs", r.PRs),
+		)
+		for _, name := range names {
+			row = append(row, formatFloat(r.Metrics[name]))
+		}
+		table = append(table, row)
+	}
+	return table
+}
+
+// writeDelimited returns a writeFunc that writes a table delimited by comma,
+// where ranks restart for each owner if perOwner is set.
+func writeDelimited(comma rune, perOwner bool) writeFunc {
+	return func(w io.Writer, repos []*topn.Repo, metric string, measured measuredSet) error {
+		cw := csv.NewWriter(w)
+		cw.Comma = comma
+		return cw.WriteAll(rows(repos, measured, perOwner, func(v float64) string {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}))
+	}
+}
+
+func writeMarkdown(w io.Writer, repos []*topn.Repo, metric string, measured measuredSet) error {
+	table := rows(repos, measured, false, func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	})
+
+	var b strings.Builder
+	for i, row := range table {
+		for j := range row {
+			row[j] = strings.ReplaceAll(row[j], "|", `\|`)
+		}
+		fmt.Fprintf(&b, "| %s |\n", strings.Join(row, " | "))
+		// Separate the header row from the rest of the table.
+		if i == 0 {
+			seps := make([]string, len(row))
+			for j := range seps {
+				seps[j] = "---"
+			}
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(seps, " | "))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,327 @@
+package format_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v33/github"
+	"github.com/vtsao/repon/format"
+	"github.com/vtsao/repon/internal/fakegithub"
+	"github.com/vtsao/repon/repo"
+	"github.com/vtsao/repon/topn"
+)
+
+func TestWrite(t *testing.T) {
+	repos := []*topn.Repo{
+		{
+			Name:    "metaflow",
+			Stars:   20787,
+			Forks:   2963,
+			PRs:     34555,
+			Metrics: map[string]float64{"contribs": 11.5},
+		},
+		{
+			Name:    "boqboqboq",
+			Stars:   64,
+			Forks:   8,
+			PRs:     1,
+			Metrics: map[string]float64{"contribs": 0.25},
+		},
+	}
+
+	tests := []struct {
+		format string
+		metric string
+		want   string
+	}{
+		{
+			format: "text",
+			metric: "stars",
+			want: `1) repo: "metaflow", stars: 20787
+2) repo: "boqboqboq", stars: 64
+`,
+		},
+		{
+			format: "text",
+			metric: "contribs",
+			want: `1) repo: "metaflow", contribution percentage: 1150.00%
+2) repo: "boqboqboq", contribution percentage: 25.00%
+`,
+		},
+		{
+			format: "json",
+			metric: "contribs",
+			want: `[
+  {
+    "rank": 1,
+    "name": "metaflow",
+    "stars": 20787,
+    "forks": 2963,
+    "prs": 34555,
+    "metrics": {
+      "contribs": 11.5
+    }
+  },
+  {
+    "rank": 2,
+    "name": "boqboqboq",
+    "stars": 64,
+    "forks": 8,
+    "prs": 1,
+    "metrics": {
+      "contribs": 0.25
+    }
+  }
+]
+`,
+		},
+		{
+			format: "csv",
+			metric: "contribs",
+			want: `rank,name,stars,forks,prs,contribs
+1,metaflow,20787,2963,34555,11.5
+2,boqboqboq,64,8,1,0.25
+`,
+		},
+		{
+			format: "tsv",
+			metric: "contribs",
+			want: "rank\tname\tstars\tforks\tprs\tcontribs\n" +
+				"1\tmetaflow\t20787\t2963\t34555\t11.5\n" +
+				"2\tboqboqboq\t64\t8\t1\t0.25\n",
+		},
+		{
+			format: "markdown",
+			metric: "contribs",
+			want: `| rank | name | stars | forks | prs | contribs |
+| --- | --- | --- | --- | --- | --- |
+| 1 | metaflow | 20787 | 2963 | 34555 | 11.50 |
+| 2 | boqboqboq | 64 | 8 | 1 | 0.25 |
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+" by "+tt.metric, func(t *testing.T) {
+			var b strings.Builder
+			if err := format.Write(&b, tt.format, repos, tt.metric, []string{"stars", "forks", "prs", "contribs"}); err != nil {
+				t.Fatalf("Write(%q, %q) failed: %v", tt.format, tt.metric, err)
+			}
+
+			if diff := cmp.Diff(tt.want, b.String()); diff != "" {
+				t.Errorf("Write(%q, %q) got diff (-want +got):\n%s", tt.format, tt.metric, diff)
+			}
+		})
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	var b strings.Builder
+	if err := format.Write(&b, "xml", nil, "stars", nil); err == nil {
+		t.Error(`Write("xml", "stars") succeeded, want error`)
+	}
+}
+
+func TestWriteOwners(t *testing.T) {
+	repos := []*topn.Repo{
+		{Owner: "netflix", Name: "metaflow", Stars: 20787, Forks: 2963},
+		{Owner: "spinnaker", Name: "spinnaker", Stars: 8000, Forks: 1000},
+		{Owner: "netflix", Name: "boqboqboq", Stars: 64, Forks: 8},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: "text",
+			want: `1) repo: "netflix/metaflow", stars: 20787
+2) repo: "spinnaker/spinnaker", stars: 8000
+3) repo: "netflix/boqboqboq", stars: 64
+`,
+		},
+		{
+			format: "csv",
+			want: `rank,owner,name,stars,forks,prs
+1,netflix,metaflow,20787,2963,0
+2,spinnaker,spinnaker,8000,1000,0
+3,netflix,boqboqboq,64,8,0
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b strings.Builder
+			if err := format.Write(&b, tt.format, repos, "stars", []string{"stars", "forks", "prs"}); err != nil {
+				t.Fatalf("Write(%q, %q) failed: %v", tt.format, "stars", err)
+			}
+
+			if diff := cmp.Diff(tt.want, b.String()); diff != "" {
+				t.Errorf("Write(%q, %q) got diff (-want +got):\n%s", tt.format, "stars", diff)
+			}
+		})
+	}
+}
+
+func TestWriteSections(t *testing.T) {
+	repos := []*topn.Repo{
+		{Owner: "netflix", Name: "metaflow", Stars: 20787, Forks: 2963},
+		{Owner: "netflix", Name: "boqboqboq", Stars: 64, Forks: 8},
+		{Owner: "spinnaker", Name: "spinnaker", Stars: 8000, Forks: 1000},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: "text",
+			want: `netflix:
+1) repo: "netflix/metaflow", stars: 20787
+2) repo: "netflix/boqboqboq", stars: 64
+
+spinnaker:
+1) repo: "spinnaker/spinnaker", stars: 8000
+`,
+		},
+		{
+			format: "json",
+			want: `[
+  {
+    "owner": "netflix",
+    "repos": [
+      {
+        "rank": 1,
+        "owner": "netflix",
+        "name": "metaflow",
+        "stars": 20787,
+        "forks": 2963,
+        "prs": 0
+      },
+      {
+        "rank": 2,
+        "owner": "netflix",
+        "name": "boqboqboq",
+        "stars": 64,
+        "forks": 8,
+        "prs": 0
+      }
+    ]
+  },
+  {
+    "owner": "spinnaker",
+    "repos": [
+      {
+        "rank": 1,
+        "owner": "spinnaker",
+        "name": "spinnaker",
+        "stars": 8000,
+        "forks": 1000,
+        "prs": 0
+      }
+    ]
+  }
+]
+`,
+		},
+		{
+			format: "tsv",
+			want: "rank\towner\tname\tstars\tforks\tprs\n" +
+				"1\tnetflix\tmetaflow\t20787\t2963\t0\n" +
+				"2\tnetflix\tboqboqboq\t64\t8\t0\n" +
+				"1\tspinnaker\tspinnaker\t8000\t1000\t0\n",
+		},
+		{
+			format: "markdown",
+			want: `## netflix
+
+| rank | owner | name | stars | forks | prs |
+| --- | --- | --- | --- | --- | --- |
+| 1 | netflix | metaflow | 20787 | 2963 | 0 |
+| 2 | netflix | boqboqboq | 64 | 8 | 0 |
+
+## spinnaker
+
+| rank | owner | name | stars | forks | prs |
+| --- | --- | --- | --- | --- | --- |
+| 1 | spinnaker | spinnaker | 8000 | 1000 | 0 |
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b strings.Builder
+			if err := format.WriteSections(&b, tt.format, repos, "stars", []string{"stars", "forks", "prs"}); err != nil {
+				t.Fatalf("WriteSections(%q, %q) failed: %v", tt.format, "stars", err)
+			}
+
+			if diff := cmp.Diff(tt.want, b.String()); diff != "" {
+				t.Errorf("WriteSections(%q, %q) got diff (-want +got):\n%s", tt.format, "stars", diff)
+			}
+		})
+	}
+}
+
+// TestWriteREST checks that the PRs the REST backend doesn't count when ranking
+// by stars are left out of the output rather than written as 0.
+func TestWriteREST(t *testing.T) {
+	ctx := context.Background()
+
+	serv := fakegithub.NewRESTServer(t, fakegithub.Netflix())
+	defer serv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL = fakegithub.BaseURL(t, serv)
+
+	backend := &repo.TopN{Client: client, FillPRsConcurrency: 1}
+	repos, err := backend.List(ctx, "netflix", 2, "stars")
+	if err != nil {
+		t.Fatalf(`List("netflix", 2, "stars") failed: %v`, err)
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: "json",
+			want: `[
+  {
+    "rank": 1,
+    "name": "metaflow",
+    "stars": 20787,
+    "forks": 2963
+  },
+  {
+    "rank": 2,
+    "name": "Hystrix",
+    "stars": 10248,
+    "forks": 728
+  }
+]
+`,
+		},
+		{
+			format: "csv",
+			want: `rank,name,stars,forks,prs
+1,metaflow,20787,2963,
+2,Hystrix,10248,728,
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b strings.Builder
+			if err := format.Write(&b, tt.format, repos, "stars", backend.Measured("stars")); err != nil {
+				t.Fatalf("Write(%q, %q) failed: %v", tt.format, "stars", err)
+			}
+			if diff := cmp.Diff(tt.want, b.String()); diff != "" {
+				t.Errorf("Write(%q, %q) got diff (-want +got):\n%s", tt.format, "stars", diff)
+			}
+		})
+	}
+}
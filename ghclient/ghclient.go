@@ -0,0 +1,81 @@
+// Package ghclient creates GitHub REST and GraphQL API clients for either
+// github.com or a GitHub Enterprise Server, which may use certificates signed
+// by a company's own certificate authority.
+package ghclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v33/github"
+	"github.com/shurcooL/githubv4"
+)
+
+// Transport returns an HTTP transport that trusts the certificates in the PEM
+// encoded caFile along with the system's certificates. If caFile is empty,
+// http.DefaultTransport is returned.
+func Transport(caFile string) (http.RoundTripper, error) {
+	if caFile == "" {
+		return http.DefaultTransport, nil
+	}
+
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		// The system's certificates aren't available on every platform, but the
+		// CA bundle may be all that's needed.
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in %q", caFile)
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return t, nil
+}
+
+// NewREST returns a REST API client for the API at apiURL, e.g.
+// "https://github.example.com/api/v3/". If apiURL is empty, github.com is used.
+func NewREST(client *http.Client, apiURL string) (*github.Client, error) {
+	if apiURL == "" {
+		return github.NewClient(client), nil
+	}
+	// Uploads aren't used, so they go to the same URL.
+	return github.NewEnterpriseClient(apiURL, apiURL, client)
+}
+
+// NewGraphQL returns a GraphQL API client for the API at graphQLURL, e.g.
+// "https://github.example.com/api/graphql". If graphQLURL is empty, github.com
+// is used.
+func NewGraphQL(client *http.Client, graphQLURL string) *githubv4.Client {
+	if graphQLURL == "" {
+		return githubv4.NewClient(client)
+	}
+	return githubv4.NewEnterpriseClient(graphQLURL, client)
+}
+
+// GraphQLURL returns the GraphQL API URL of the GitHub Enterprise Server whose
+// REST API is at apiURL. GitHub Enterprise Server serves the REST API under
+// /api/v3 and the GraphQL API at /api/graphql.
+func GraphQLURL(apiURL string) (string, error) {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("API URL %q must be absolute", apiURL)
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	path = strings.TrimSuffix(path, "/api/v3")
+	u.Path = path + "/api/graphql"
+	return u.String(), nil
+}
@@ -0,0 +1,166 @@
+package ghclient_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/ghclient"
+	"github.com/vtsao/repon/internal/fakegithub"
+	"github.com/vtsao/repon/repo"
+	"github.com/vtsao/repon/repoql"
+	"github.com/vtsao/repon/topn"
+)
+
+// writeCA writes the certificate of serv to a PEM encoded CA bundle.
+func writeCA(t *testing.T, serv *httptest.Server) string {
+	t.Helper()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, b, 0600); err != nil {
+		t.Fatalf("WriteFile(%q) failed: %v", caFile, err)
+	}
+	return caFile
+}
+
+// newHTTPClient returns a client that trusts the certificates in caFile.
+func newHTTPClient(t *testing.T, caFile string) *http.Client {
+	t.Helper()
+
+	transport, err := ghclient.Transport(caFile)
+	if err != nil {
+		t.Fatalf("Transport(%q) failed: %v", caFile, err)
+	}
+	return &http.Client{Transport: transport}
+}
+
+func TestNewREST(t *testing.T) {
+	serv := fakegithub.NewRESTServer(t, fakegithub.Netflix(), fakegithub.WithEnterprise())
+	defer serv.Close()
+
+	tests := []struct {
+		desc    string
+		caFile  string
+		wantErr bool
+	}{
+		{
+			desc:   "trusted CA",
+			caFile: writeCA(t, serv),
+		},
+		{
+			desc:    "untrusted CA",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client, err := ghclient.NewREST(newHTTPClient(t, tt.caFile), serv.URL+"/api/v3/")
+			if err != nil {
+				t.Fatalf("NewREST(%q) failed: %v", serv.URL+"/api/v3/", err)
+			}
+			backend := repo.TopN{Client: client, FillPRsConcurrency: 1}
+
+			repos, err := backend.List(context.Background(), "netflix", 2, "stars")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf(`List("netflix", 2, "stars") got error %v, want error: %v`, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// Unlike GraphQL, REST doesn't measure PRs when ranking by stars.
+			if diff := cmp.Diff([]string{"stars", "forks"}, backend.Measured("stars")); diff != "" {
+				t.Errorf(`Measured("stars") got diff (-want +got):\n%s`, diff)
+			}
+			wantRepos := []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963},
+				{Name: "Hystrix", Stars: 10248, Forks: 728},
+			}
+			if diff := cmp.Diff(wantRepos, repos); diff != "" {
+				t.Errorf(`List("netflix", 2, "stars") got diff (-want +got):\n%s`, diff)
+			}
+		})
+	}
+}
+
+func TestNewGraphQL(t *testing.T) {
+	serv := fakegithub.NewGraphQLServer(t, fakegithub.Netflix(), fakegithub.WithEnterprise())
+	defer serv.Close()
+
+	graphQLURL, err := ghclient.GraphQLURL(serv.URL + "/api/v3")
+	if err != nil {
+		t.Fatalf("GraphQLURL(%q) failed: %v", serv.URL+"/api/v3", err)
+	}
+	client := ghclient.NewGraphQL(newHTTPClient(t, writeCA(t, serv)), graphQLURL)
+	backend := repoql.TopN{Client: client}
+
+	repos, err := backend.List(context.Background(), "netflix", 2, "stars")
+	if err != nil {
+		t.Fatalf(`List("netflix", 2, "stars") failed: %v`, err)
+	}
+
+	wantRepos := []*topn.Repo{
+		{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555},
+		{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0},
+	}
+	if diff := cmp.Diff(wantRepos, repos); diff != "" {
+		t.Errorf(`List("netflix", 2, "stars") got diff (-want +got):\n%s`, diff)
+	}
+}
+
+func TestGraphQLURL(t *testing.T) {
+	tests := []struct {
+		apiURL  string
+		want    string
+		wantErr bool
+	}{
+		{
+			apiURL: "https://github.example.com/api/v3/",
+			want:   "https://github.example.com/api/graphql",
+		},
+		{
+			apiURL: "https://github.example.com/api/v3",
+			want:   "https://github.example.com/api/graphql",
+		},
+		{
+			apiURL: "https://github.example.com",
+			want:   "https://github.example.com/api/graphql",
+		},
+		{
+			apiURL:  "github.example.com/api/v3",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.apiURL, func(t *testing.T) {
+			got, err := ghclient.GraphQLURL(tt.apiURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GraphQLURL(%q) got error %v, want error: %v", tt.apiURL, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GraphQLURL(%q) = %q, want %q", tt.apiURL, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransportBadCA(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("WriteFile(%q) failed: %v", caFile, err)
+	}
+
+	for _, f := range []string{caFile, filepath.Join(t.TempDir(), "missing.pem")} {
+		if _, err := ghclient.Transport(f); err == nil {
+			t.Errorf("Transport(%q) succeeded, want error", f)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Package httpcache implements an HTTP transport that caches GitHub API
+// responses on disk, so repeated runs against the same org don't download
+// every page again.
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often a Transport prunes its directory of old entries.
+const pruneInterval = time.Hour
+
+// Transport is an http.RoundTripper that caches successful GET responses in a
+// directory. Responses younger than TTL are served from the cache without a
+// request. Older ones are revalidated with If-None-Match and If-Modified-Since
+// conditional requests, and served from the cache if GitHub responds 304 Not
+// Modified, which doesn't count against the REST API rate limit.
+//
+// Responses served from the cache without a request don't have GitHub's
+// X-RateLimit-* headers, since they'd be stale.
+//
+// Responses are cached by URL and Accept header, but not by who made the
+// request, so the directory should only be readable by the user it caches
+// responses for. GraphQL queries are POST requests and aren't cached.
+type Transport struct {
+	// Base is the transport used to make requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+	// Dir is the directory responses are cached in, which is created if
+	// needed.
+	Dir string
+	// TTL is how long cached responses are served without revalidating them.
+	// Zero means they're always revalidated.
+	TTL time.Duration
+	// MaxAge is how long cached responses are kept after they were last stored
+	// or revalidated, so the directory doesn't grow with every URL ever
+	// requested. Older entries are deleted at most once every hour. Zero means
+	// they're kept forever.
+	MaxAge time.Duration
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base().RoundTrip(req)
+	}
+
+	t.maybePrune()
+	path := t.path(req)
+	cached, storedAt := t.load(path, req)
+	if cached != nil && time.Since(storedAt) < t.TTL {
+		stripRateLimit(cached.Header)
+		return cached, nil
+	}
+
+	r := req
+	if cached != nil {
+		r = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			r.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+	resp, err := t.base().RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		// The 304 has the current rate limit headers, and any new validators.
+		for k, v := range resp.Header {
+			cached.Header[k] = v
+		}
+		now := time.Now()
+		if err := os.Chtimes(path, now, now); err != nil {
+			log.Printf("Error refreshing cached response for %s: %v", req.URL, err)
+		}
+		return cached, nil
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := t.store(path, resp); err != nil {
+			log.Printf("Error caching response for %s: %v", req.URL, err)
+		}
+	}
+	return resp, nil
+}
+
+// path returns the file req's response is cached in.
+func (t *Transport) path(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Accept")))
+	return filepath.Join(t.Dir, hex.EncodeToString(sum[:]))
+}
+
+// load returns the cached response for req from the file at path and when it
+// was stored, or nil if there isn't one. Unreadable entries are treated as
+// missing, since they'll be replaced.
+func (t *Transport) load(path string, req *http.Request) (*http.Response, time.Time) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, time.Time{}
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, info.ModTime()
+}
+
+// store caches resp in the file at path, replacing resp's body so it can still
+// be read. The file is replaced atomically so concurrent requests never see a
+// partial entry.
+func (t *Transport) store(path string, resp *http.Response) error {
+	// DumpResponse replaces the body with a copy.
+	b, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(t.Dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(t.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// stripRateLimit removes GitHub's rate limit headers from h.
+func stripRateLimit(h http.Header) {
+	for k := range h {
+		if strings.HasPrefix(k, "X-Ratelimit-") {
+			delete(h, k)
+		}
+	}
+}
+
+// maybePrune prunes the directory if it hasn't been for pruneInterval.
+func (t *Transport) maybePrune() {
+	if t.MaxAge <= 0 {
+		return
+	}
+	t.mu.Lock()
+	if time.Since(t.lastPruned) < pruneInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.lastPruned = time.Now()
+	t.mu.Unlock()
+
+	if err := t.Prune(); err != nil {
+		log.Printf("Error pruning cached responses in %s: %v", t.Dir, err)
+	}
+}
+
+// Prune deletes the cached responses that were last stored or revalidated more
+// than MaxAge ago, along with any temporary files left behind by interrupted
+// stores. It does nothing if MaxAge is zero.
+func (t *Transport) Prune() error {
+	if t.MaxAge <= 0 {
+		return nil
+	}
+	infos, err := ioutil.ReadDir(t.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-t.MaxAge)
+	for _, info := range infos {
+		if info.IsDir() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(t.Dir, info.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package httpcache_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/httpcache"
+)
+
+// etagServ creates a server that responds with the current version of its body
+// and an ETag for it, or 304 Not Modified if the request has that ETag. It
+// also records the status of every response.
+func etagServ(t *testing.T) (serv *httptest.Server, setVersion func(string), statuses func() []int) {
+	t.Helper()
+
+	var mu sync.Mutex
+	version := "v1"
+	var sent []int
+	serv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		etag := `"` + version + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			sent = append(sent, http.StatusNotModified)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.URL.Path == "/missing" {
+			sent = append(sent, http.StatusNotFound)
+			http.NotFound(w, r)
+			return
+		}
+		sent = append(sent, http.StatusOK)
+		io.WriteString(w, version+" of "+r.Method+" "+r.URL.Path)
+	}))
+
+	setVersion = func(v string) {
+		mu.Lock()
+		defer mu.Unlock()
+		version = v
+	}
+	statuses = func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), sent...)
+	}
+	return serv, setVersion, statuses
+}
+
+func TestRoundTrip(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		// version is the server's version when the request is made.
+		version string
+	}
+	tests := []struct {
+		desc         string
+		ttl          time.Duration
+		requests     []request
+		wantBodies   []string
+		wantStatuses []int
+	}{
+		{
+			desc: "revalidates",
+			requests: []request{
+				{method: "GET", path: "/repos", version: "v1"},
+				{method: "GET", path: "/repos", version: "v1"},
+			},
+			wantBodies:   []string{"v1 of GET /repos", "v1 of GET /repos"},
+			wantStatuses: []int{200, 304},
+		},
+		{
+			desc: "changed",
+			requests: []request{
+				{method: "GET", path: "/repos", version: "v1"},
+				{method: "GET", path: "/repos", version: "v2"},
+				{method: "GET", path: "/repos", version: "v2"},
+			},
+			wantBodies:   []string{"v1 of GET /repos", "v2 of GET /repos", "v2 of GET /repos"},
+			wantStatuses: []int{200, 200, 304},
+		},
+		{
+			desc: "fresh",
+			ttl:  time.Hour,
+			requests: []request{
+				{method: "GET", path: "/repos", version: "v1"},
+				{method: "GET", path: "/repos", version: "v2"},
+			},
+			wantBodies:   []string{"v1 of GET /repos", "v1 of GET /repos"},
+			wantStatuses: []int{200},
+		},
+		{
+			desc: "by URL",
+			ttl:  time.Hour,
+			requests: []request{
+				{method: "GET", path: "/repos?page=1", version: "v1"},
+				{method: "GET", path: "/repos?page=2", version: "v1"},
+			},
+			wantBodies:   []string{"v1 of GET /repos", "v1 of GET /repos"},
+			wantStatuses: []int{200, 200},
+		},
+		{
+			desc: "POST isn't cached",
+			ttl:  time.Hour,
+			requests: []request{
+				{method: "POST", path: "/graphql", version: "v1"},
+				{method: "POST", path: "/graphql", version: "v1"},
+			},
+			wantBodies:   []string{"v1 of POST /graphql", "v1 of POST /graphql"},
+			wantStatuses: []int{200, 200},
+		},
+		{
+			desc: "errors aren't cached",
+			ttl:  time.Hour,
+			requests: []request{
+				{method: "GET", path: "/missing", version: "v1"},
+				{method: "GET", path: "/missing", version: "v1"},
+			},
+			wantBodies:   []string{"404 page not found\n", "404 page not found\n"},
+			wantStatuses: []int{404, 404},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			serv, setVersion, statuses := etagServ(t)
+			defer serv.Close()
+			client := &http.Client{Transport: &httpcache.Transport{Dir: t.TempDir(), TTL: tt.ttl}}
+
+			var bodies []string
+			for _, r := range tt.requests {
+				setVersion(r.version)
+				req, err := http.NewRequest(r.method, serv.URL+r.path, strings.NewReader(""))
+				if err != nil {
+					t.Fatalf("NewRequest() failed: %v", err)
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatalf("%s %s failed: %v", r.method, r.path, err)
+				}
+				b, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					t.Fatalf("ReadAll() failed: %v", err)
+				}
+				bodies = append(bodies, string(b))
+			}
+
+			if diff := cmp.Diff(tt.wantBodies, bodies); diff != "" {
+				t.Errorf("got bodies diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantStatuses, statuses()); diff != "" {
+				t.Errorf("got server statuses diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRoundTripAccept(t *testing.T) {
+	serv, _, statuses := etagServ(t)
+	defer serv.Close()
+	client := &http.Client{Transport: &httpcache.Transport{Dir: t.TempDir(), TTL: time.Hour}}
+
+	// Responses for different media types are cached separately.
+	for _, accept := range []string{"application/vnd.github.v3+json", "application/vnd.github.mercy-preview+json"} {
+		req, err := http.NewRequest("GET", serv.URL+"/repos", nil)
+		if err != nil {
+			t.Fatalf("NewRequest() failed: %v", err)
+		}
+		req.Header.Set("Accept", accept)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET /repos failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if diff := cmp.Diff([]int{200, 200}, statuses()); diff != "" {
+		t.Errorf("got server statuses diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRoundTripRateLimit(t *testing.T) {
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.Header().Set("X-RateLimit-Reset", "1608541200")
+		io.WriteString(w, "repos")
+	}))
+	defer serv.Close()
+	client := &http.Client{Transport: &httpcache.Transport{Dir: t.TempDir(), TTL: time.Hour}}
+
+	var remaining []string
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(serv.URL + "/repos")
+		if err != nil {
+			t.Fatalf("GET /repos failed: %v", err)
+		}
+		resp.Body.Close()
+		remaining = append(remaining, resp.Header.Get("X-RateLimit-Remaining"))
+	}
+
+	// The cached response's rate limit is stale, so it's left out.
+	if diff := cmp.Diff([]string{"4999", ""}, remaining); diff != "" {
+		t.Errorf("got X-RateLimit-Remaining diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	serv, _, statuses := etagServ(t)
+	defer serv.Close()
+	dir := t.TempDir()
+	transport := &httpcache.Transport{Dir: dir, TTL: time.Hour, MaxAge: 24 * time.Hour}
+	client := &http.Client{Transport: transport}
+
+	for _, path := range []string{"/old", "/new"} {
+		resp, err := client.Get(serv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() failed: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("got %d cached responses, want 2", len(infos))
+	}
+	// Age the entry for /old, which was cached first.
+	old := time.Now().Add(-48 * time.Hour)
+	for _, info := range infos {
+		b, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			t.Fatalf("ReadFile() failed: %v", err)
+		}
+		if strings.Contains(string(b), "GET /old") {
+			if err := os.Chtimes(filepath.Join(dir, info.Name()), old, old); err != nil {
+				t.Fatalf("Chtimes() failed: %v", err)
+			}
+		}
+	}
+
+	if err := transport.Prune(); err != nil {
+		t.Fatalf("Prune() failed: %v", err)
+	}
+	for _, path := range []string{"/old", "/new"} {
+		resp, err := client.Get(serv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+
+	// Only /old is requested again, since /new is still cached.
+	if diff := cmp.Diff([]int{200, 200, 200}, statuses()); diff != "" {
+		t.Errorf("got server statuses diff (-want +got):\n%s", diff)
+	}
+}
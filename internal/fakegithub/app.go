@@ -0,0 +1,142 @@
+package fakegithub
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// app is a fake GitHub App installed once, which issues installation tokens.
+type app struct {
+	id, installationID int64
+	key                *rsa.PublicKey
+	ttl                time.Duration
+
+	mu sync.Mutex
+	// issued is when each installation token issued expires.
+	issued map[string]time.Time
+}
+
+// WithApp makes the fake REST server issue installation tokens for the GitHub
+// App with the ID and public key, installed with installationID. Tokens are
+// named "ghs_1", "ghs_2", etc. and expire after ttl. Every other request must
+// be authenticated with an unexpired installation token.
+func WithApp(id, installationID int64, key *rsa.PublicKey, ttl time.Duration) Option {
+	return func(o *options) {
+		o.app = &app{id: id, installationID: installationID, key: key, ttl: ttl, issued: make(map[string]time.Time)}
+	}
+}
+
+// accessTokens handles requests to create an installation token, which must be
+// authenticated with a JWT signed by the app.
+func (a *app) accessTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if id := mux.Vars(r)["id"]; id != strconv.FormatInt(a.installationID, 10) {
+		http.NotFound(w, r)
+		return
+	}
+	if err := a.verify(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, `{"message": %q}`, err.Error())
+		return
+	}
+
+	a.mu.Lock()
+	token := fmt.Sprintf("ghs_%d", len(a.issued)+1)
+	expiresAt := time.Now().Add(a.ttl).UTC()
+	a.issued[token] = expiresAt
+	a.mu.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"token": token, "expires_at": expiresAt})
+}
+
+// verify returns an error if jwt isn't a valid JWT for the app.
+func (a *app) verify(jwt string) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return errors.New("A JSON web token could not be decoded")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	var claims struct {
+		IAT int64 `json:"iat"`
+		EXP int64 `json:"exp"`
+		ISS int64 `json:"iss"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return err
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+
+	if header.Alg != "RS256" {
+		return fmt.Errorf("unsupported JWT algorithm %q", header.Alg)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(a.key, crypto.SHA256, digest[:], sig); err != nil {
+		return errors.New("A JSON web token could not be decoded")
+	}
+	if claims.ISS != a.id {
+		return fmt.Errorf("'Issuer' claim ('iss') must be %d", a.id)
+	}
+	now := time.Now()
+	if time.Unix(claims.IAT, 0).After(now) {
+		return errors.New("'Issued at' claim ('iat') must be an Integer representing a time in the past")
+	}
+	if !time.Unix(claims.EXP, 0).After(now) || claims.EXP-claims.IAT > int64((10*time.Minute+time.Minute)/time.Second) {
+		return errors.New("'Expiration time' claim ('exp') is too far in the future or has passed")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// authenticate wraps next to require an unexpired installation token.
+func (a *app) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/app/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(strings.TrimPrefix(auth, "token "), "Bearer ")
+		a.mu.Lock()
+		expiresAt, ok := a.issued[token]
+		a.mu.Unlock()
+		if !ok || !expiresAt.After(time.Now()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"message": "Bad credentials"}`)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,1321 @@
+// Package fakegithub implements simplified fakes of the GitHub REST API and
+// GitHub GraphQL API that serve a fixed set of repositories, for use in tests.
+package fakegithub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v33/github"
+	"github.com/gorilla/mux"
+	"github.com/vtsao/repon/topn"
+)
+
+// searchLimit is the maximum number of results GitHub's Search API returns for
+// a single query.
+const searchLimit = 1000
+
+// Repo is a fake repository served by the fake servers.
+type Repo struct {
+	Name      string
+	Stars     int
+	Forks     int
+	PRs       int
+	HasIssues bool
+	// OpenIssues is the number of open issues, not including open PRs.
+	OpenIssues   int
+	OpenPRs      int
+	Watchers     int
+	Releases     int
+	Contributors int
+	// Commits is the number of commits on the default branch. Repos without
+	// commits are empty.
+	Commits int
+	// Size is the disk size in KB.
+	Size int
+
+	// Language, Topics, Archived, Fork, Mirror, Visibility and PushedAt are what
+	// repos are filtered on. Visibility defaults to "public".
+	Language   string
+	Topics     []string
+	Archived   bool
+	Fork       bool
+	Mirror     bool
+	Visibility string
+	PushedAt   time.Time
+
+	// Pulls, IssuesCreated, StarredAt and ForkedAt are the repo's activity over
+	// time for windowed metrics. Unlike the counts above, they needn't be
+	// complete.
+	Pulls         []Pull
+	IssuesCreated []time.Time
+	StarredAt     []time.Time
+	ForkedAt      []time.Time
+}
+
+// Pull is a fake pull request.
+type Pull struct {
+	Created time.Time
+	// Merged is zero if the PR isn't merged.
+	Merged time.Time
+}
+
+// Q4 is the window the windowed activity in Netflix is mostly within.
+var Q4 = topn.Window{
+	Since: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+	Until: time.Date(2020, 12, 31, 23, 59, 59, 0, time.UTC),
+}
+
+// day returns midday on the day offset days from the start of Q4.
+func day(offset int) time.Time {
+	return Q4.Since.AddDate(0, 0, offset).Add(12 * time.Hour)
+}
+
+// days returns midday on each of the days offset from the start of Q4.
+func days(offsets ...int) []time.Time {
+	var ts []time.Time
+	for _, offset := range offsets {
+		ts = append(ts, day(offset))
+	}
+	return ts
+}
+
+// hourly returns n times an hour apart, starting on the day offset from the
+// start of Q4.
+func hourly(n, offset int) []time.Time {
+	var ts []time.Time
+	for i := 0; i < n; i++ {
+		ts = append(ts, day(offset).Add(time.Duration(i)*time.Hour))
+	}
+	return ts
+}
+
+// Netflix returns a small set of fake repositories for the "netflix" org.
+func Netflix() []Repo {
+	return []Repo{
+		{
+			Name: "security_monkey", Stars: 10047, Forks: 792, PRs: 55, HasIssues: true,
+			OpenIssues: 20, OpenPRs: 3, Watchers: 500, Releases: 40, Contributors: 120, Commits: 2400, Size: 9000,
+			Language: "Python", Topics: []string{"security", "aws"}, Archived: true, PushedAt: day(-400),
+			Pulls: []Pull{
+				{Created: day(-30), Merged: day(4)},
+				{Created: day(9), Merged: day(11)},
+				{Created: day(31)},
+				{Created: day(96), Merged: day(97)},
+			},
+			IssuesCreated: days(-16, 19),
+			StarredAt:     days(-61, 1, 2),
+			ForkedAt:      days(-5, 2, 50),
+		},
+		{
+			Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555, HasIssues: true,
+			OpenIssues: 150, OpenPRs: 30, Watchers: 280, Releases: 60, Contributors: 70, Commits: 1500, Size: 25000,
+			Language: "Python", Topics: []string{"ml", "python", "data-science"}, PushedAt: day(90),
+			Pulls: []Pull{
+				{Created: day(0), Merged: day(1)},
+				{Created: day(1)},
+				{Created: day(2), Merged: day(3)},
+				{Created: day(34)},
+				{Created: day(65), Merged: day(66)},
+			},
+			IssuesCreated: days(6, 38, 39, 70),
+			// More stars than fit on a page in the window.
+			StarredAt: append(hourly(150, -30), hourly(120, 10)...),
+			// More forks than fit on a page in the window.
+			ForkedAt: append(hourly(110, 20), day(-3)),
+		},
+		{
+			Name: "SimianArmy", Stars: 0, Forks: 4253, PRs: 39811, HasIssues: true,
+			OpenIssues: 5, OpenPRs: 0, Watchers: 700, Releases: 10, Contributors: 90, Commits: 1700, Size: 8000,
+			Language: "Java", Topics: []string{"chaos-engineering"}, Archived: true, PushedAt: day(-700),
+			Pulls: []Pull{
+				{Created: day(-100), Merged: day(-99)},
+			},
+		},
+		{
+			Name: "chaosmonkey", Stars: 1, Forks: 1017, PRs: 1, HasIssues: true,
+			OpenIssues: 12, OpenPRs: 1, Watchers: 300, Releases: 25, Contributors: 40, Commits: 700, Size: 4000,
+			Language: "Go", Topics: []string{"chaos-engineering"}, PushedAt: day(20),
+			Pulls: []Pull{
+				{Created: day(50), Merged: day(51)},
+			},
+			IssuesCreated: days(1, 2, 3),
+			StarredAt:     days(-200),
+			ForkedAt:      days(10),
+		},
+		{
+			Name: "zuul", Stars: 0, Forks: 0, PRs: 2305, HasIssues: false,
+			OpenIssues: 0, OpenPRs: 10, Watchers: 1200, Releases: 90, Contributors: 110, Commits: 3000, Size: 30000,
+			Language: "Java", Topics: []string{"gateway"}, PushedAt: day(85),
+			Pulls: []Pull{
+				{Created: day(-10), Merged: day(5)},
+				{Created: day(-5), Merged: day(6)},
+				{Created: day(1), Merged: day(2)},
+				{Created: day(3), Merged: day(80)},
+				{Created: day(40)},
+			},
+		},
+		{
+			Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0, HasIssues: true,
+			OpenIssues: 300, OpenPRs: 0, Watchers: 1000, Releases: 20, Contributors: 100, Commits: 2100, Size: 12000,
+			Language: "Java", Topics: []string{"resilience"}, PushedAt: day(-300),
+			Pulls: []Pull{
+				{Created: day(10)},
+				{Created: day(20)},
+				{Created: day(30)},
+				{Created: day(40)},
+			},
+			IssuesCreated: days(5, 90),
+			StarredAt:     days(3, 4, 5, 6),
+			ForkedAt:      days(-20),
+		},
+		{
+			Name: "boqboqboq", Stars: 64, Forks: 9, PRs: 1, HasIssues: true,
+			OpenIssues: 2, OpenPRs: 1, Watchers: 3, Releases: 0, Contributors: 1, Commits: 0, Size: 0,
+			Language: "Go", Fork: true, Visibility: "private", PushedAt: day(1),
+		},
+	}
+}
+
+// Option configures a fake server.
+type Option func(*options)
+
+type options struct {
+	rateLimited int
+	orgs        map[string][]Repo
+	users       map[string][]Repo
+	latency     time.Duration
+	enterprise  bool
+	app         *app
+}
+
+// WithRateLimit makes the first n requests to a fake server fail as rate
+// limited. The REST server alternates between primary (403) and secondary (429)
+// rate limit responses, while the GraphQL server returns RATE_LIMITED errors.
+// Every response says the rate limit has already reset.
+func WithRateLimit(n int) Option {
+	return func(o *options) { o.rateLimited = n }
+}
+
+// WithLatency delays each response from a fake server by a random duration
+// averaging d, so that some requests are much slower than others.
+func WithLatency(d time.Duration) Option {
+	return func(o *options) { o.latency = d }
+}
+
+// delay wraps next to delay each response by a random duration averaging d.
+func delay(next http.Handler, d time.Duration) http.Handler {
+	if d <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(2 * d)))):
+		case <-r.Context().Done():
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithEnterprise makes a fake server look like GitHub Enterprise Server, which
+// serves the REST API under /api/v3 and the GraphQL API at /api/graphql. The
+// server uses TLS with its own certificate, see httptest.Server.Certificate.
+func WithEnterprise() Option {
+	return func(o *options) { o.enterprise = true }
+}
+
+// serve starts a server for the API handler, mounted at prefix for GitHub
+// Enterprise Server.
+func (o *options) serve(handler http.Handler, prefix string) *httptest.Server {
+	if !o.enterprise {
+		return httptest.NewServer(handler)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, handler))
+	return httptest.NewTLSServer(mux)
+}
+
+// WithOrg makes a fake server serve repos for the org instead of the default
+// repos.
+func WithOrg(org string, repos []Repo) Option {
+	return func(o *options) {
+		if o.orgs == nil {
+			o.orgs = make(map[string][]Repo)
+		}
+		o.orgs[org] = repos
+	}
+}
+
+// WithUser makes a fake server serve repos for the user account. Unlike orgs,
+// users don't have the default repos.
+func WithUser(user string, repos []Repo) Option {
+	return func(o *options) {
+		if o.users == nil {
+			o.users = make(map[string][]Repo)
+		}
+		o.users[user] = repos
+	}
+}
+
+// reposFor returns the repos to serve for the org or user.
+func (o *options) reposFor(owner string, repos []Repo) []Repo {
+	if orgRepos, ok := o.orgs[owner]; ok {
+		return orgRepos
+	}
+	if userRepos, ok := o.users[owner]; ok {
+		return userRepos
+	}
+	return repos
+}
+
+// isUser returns whether the owner is a user account rather than an org.
+func (o *options) isUser(owner string) bool {
+	_, ok := o.users[owner]
+	return ok
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// rateLimit wraps next to serve rate limited responses from limited for the
+// first n requests.
+func rateLimit(next http.Handler, n int, limited func(w http.ResponseWriter, count int)) http.Handler {
+	var mu sync.Mutex
+	count := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		count++
+		c := count
+		mu.Unlock()
+
+		if c > n {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+		limited(w, c)
+	})
+}
+
+func restRateLimited(w http.ResponseWriter, count int) {
+	if count%2 == 1 {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"message": "API rate limit exceeded"}`)
+		return
+	}
+	w.Header().Set("X-RateLimit-Remaining", "4999")
+	w.Header().Set("Retry-After", "0")
+	w.WriteHeader(http.StatusTooManyRequests)
+	io.WriteString(w, `{"message": "You have exceeded a secondary rate limit."}`)
+}
+
+func graphQLRateLimited(w http.ResponseWriter, count int) {
+	io.WriteString(w, `{"errors": [{"type": "RATE_LIMITED", "message": "API rate limit exceeded"}]}`)
+}
+
+// Generate returns n fake repositories named "repo-0000", "repo-0001", etc.,
+// where later repos have more stars and PRs and fewer forks.
+func Generate(n int) []Repo {
+	repos := make([]Repo, 0, n)
+	for i := 0; i < n; i++ {
+		repos = append(repos, Repo{
+			Name:         fmt.Sprintf("repo-%04d", i),
+			Stars:        i,
+			Forks:        n - i,
+			PRs:          2 * i,
+			HasIssues:    true,
+			OpenIssues:   n - i,
+			OpenPRs:      i % 7,
+			Watchers:     2 * i,
+			Releases:     i,
+			Contributors: i,
+			Commits:      3 * i,
+			Size:         10 * i,
+		})
+	}
+	return repos
+}
+
+// page returns the [start, end) bounds of the 1-indexed page of size perPage
+// for a list of length n.
+func page(n, pageNum, perPage int) (start, end int) {
+	if pageNum < 1 {
+		pageNum = 1
+	}
+	if perPage < 1 {
+		perPage = 30
+	}
+	start = (pageNum - 1) * perPage
+	if start > n {
+		start = n
+	}
+	end = start + perPage
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+// setPageLinks sets the Link response header pointing at the next and last
+// pages of r if there are more pages.
+func setPageLinks(w http.ResponseWriter, r *http.Request, end, n, perPage int) {
+	if end >= n {
+		return
+	}
+	pageNum, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if pageNum < 1 {
+		pageNum = 1
+	}
+	if perPage < 1 {
+		perPage = 30
+	}
+	link := func(pageNum int) string {
+		u := *r.URL
+		q := u.Query()
+		q.Set("page", strconv.Itoa(pageNum))
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	lastPage := (n + perPage - 1) / perPage
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\", <%s>; rel=\"last\"", link(pageNum+1), link(lastPage)))
+}
+
+func toGitHub(r Repo) *github.Repository {
+	gr := &github.Repository{
+		Name:            github.String(r.Name),
+		StargazersCount: github.Int(r.Stars),
+		ForksCount:      github.Int(r.Forks),
+		HasIssues:       github.Bool(r.HasIssues),
+		// Like the real API, open issues include open PRs.
+		OpenIssuesCount: github.Int(r.OpenIssues + r.OpenPRs),
+		Size:            github.Int(r.Size),
+		DefaultBranch:   github.String("main"),
+		Topics:          r.Topics,
+		Archived:        github.Bool(r.Archived),
+		Fork:            github.Bool(r.Fork),
+		Private:         github.Bool(r.visibility() != "public"),
+		Visibility:      github.String(r.visibility()),
+	}
+	if r.Language != "" {
+		gr.Language = github.String(r.Language)
+	}
+	if r.Mirror {
+		gr.MirrorURL = github.String("https://example.com/" + r.Name + ".git")
+	}
+	if !r.PushedAt.IsZero() {
+		gr.PushedAt = &github.Timestamp{Time: r.PushedAt}
+	}
+	return gr
+}
+
+// attrs returns the attributes of r that are filtered on.
+func (r Repo) attrs() topn.Attrs {
+	return topn.Attrs{
+		Name:       r.Name,
+		Language:   r.Language,
+		Topics:     r.Topics,
+		Archived:   r.Archived,
+		Fork:       r.Fork,
+		Mirror:     r.Mirror,
+		Visibility: r.visibility(),
+		Stars:      r.Stars,
+		PushedAt:   r.PushedAt,
+	}
+}
+
+func (r Repo) visibility() string {
+	if r.Visibility == "" {
+		return "public"
+	}
+	return r.Visibility
+}
+
+// writeCount writes a response to a list request with a page size of 1 for a
+// list with count items.
+func writeCount(t testing.TB, w http.ResponseWriter, r *http.Request, count int) {
+	t.Helper()
+
+	// Set response pagination headers.
+	if count > 0 {
+		// Since the TopN tool always pages by 1 and only looks at the last page to
+		// get the total, this is the only page header we need to set.
+		q := r.URL.Query()
+		q.Set("page", fmt.Sprintf("%d", count))
+		r.URL.RawQuery = q.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"last\"", r.URL))
+	}
+
+	// We only return one object here in this fake b/c the TopN tool always pages
+	// by 1 when counting and we can return an empty object b/c the tool also
+	// doesn't care about the object's contents, only the length.
+	items := []struct{}{}
+	if count > 0 {
+		items = append(items, struct{}{})
+	}
+	writeJSON(t, w, items)
+}
+
+func writeJSON(t testing.TB, w http.ResponseWriter, v interface{}) {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal(%+v) failed: %v", v, err)
+	}
+	w.Write(b)
+}
+
+// issuesQuery is a parsed issue search query.
+type issuesQuery struct {
+	owner, repo string
+	// times returns when the matching issues or PRs in a repo happened.
+	times  func(r Repo) []time.Time
+	window topn.Window
+}
+
+// parseIssuesQuery parses an issue search query. We only support queries of the
+// form "repo:<owner>/<repo> is:pr [is:merged] <created|merged>:<from>..<to>"
+// and "repo:<owner>/<repo> is:issue created:<from>..<to>".
+func parseIssuesQuery(query string) (*issuesQuery, error) {
+	q := &issuesQuery{}
+	var isPR, isIssue, isMerged bool
+	var dateField string
+	for _, term := range strings.Fields(query) {
+		parts := strings.SplitN(term, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unsupported term %q", term)
+		}
+		switch key, value := parts[0], parts[1]; key {
+		case "repo":
+			nwo := strings.SplitN(value, "/", 2)
+			if len(nwo) != 2 {
+				return nil, fmt.Errorf("bad repo %q", value)
+			}
+			q.owner, q.repo = nwo[0], nwo[1]
+		case "is":
+			switch value {
+			case "pr":
+				isPR = true
+			case "issue":
+				isIssue = true
+			case "merged":
+				isMerged = true
+			default:
+				return nil, fmt.Errorf("unsupported term %q", term)
+			}
+		case "created", "merged":
+			dateField = key
+			bounds := strings.SplitN(value, "..", 2)
+			if len(bounds) != 2 {
+				return nil, fmt.Errorf("bad date range %q", value)
+			}
+			var err error
+			if q.window.Since, err = parseSearchDate(bounds[0]); err != nil {
+				return nil, err
+			}
+			if q.window.Until, err = parseSearchDate(bounds[1]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported term %q", term)
+		}
+	}
+
+	switch {
+	case isIssue && dateField == "created":
+		q.times = func(r Repo) []time.Time { return r.IssuesCreated }
+	case isPR && !isMerged && dateField == "created":
+		q.times = func(r Repo) []time.Time {
+			var ts []time.Time
+			for _, pull := range r.Pulls {
+				ts = append(ts, pull.Created)
+			}
+			return ts
+		}
+	case isPR && isMerged && dateField == "merged":
+		q.times = func(r Repo) []time.Time {
+			var ts []time.Time
+			for _, pull := range r.Pulls {
+				if !pull.Merged.IsZero() {
+					ts = append(ts, pull.Merged)
+				}
+			}
+			return ts
+		}
+	default:
+		return nil, fmt.Errorf("unsupported query %q", query)
+	}
+	return q, nil
+}
+
+// repoQuery is a parsed repo search query.
+type repoQuery struct {
+	qualifier, owner string
+	filter           topn.Filter
+}
+
+// parseRepoQuery parses a repo search query. We only support queries of the
+// form "<org|user>:<owner>" followed by the qualifiers of topn.Filter. Like the
+// real Search API, forks are left out unless there's a fork qualifier.
+func parseRepoQuery(query string) (*repoQuery, error) {
+	q := &repoQuery{}
+	q.filter.Fork = github.Bool(false)
+	terms, err := searchTerms(query)
+	if err != nil {
+		return nil, err
+	}
+	for _, term := range terms {
+		parts := strings.SplitN(term, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unsupported term %q", term)
+		}
+		switch key, value := parts[0], parts[1]; key {
+		case "org", "user":
+			q.qualifier, q.owner = key, value
+		case "language":
+			q.filter.Language = value
+		case "topic":
+			q.filter.Topic = value
+		case "archived", "mirror":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("bad term %q: %v", term, err)
+			}
+			if key == "archived" {
+				q.filter.Archived = &b
+			} else {
+				q.filter.Mirror = &b
+			}
+		case "fork":
+			switch value {
+			case "true":
+				q.filter.Fork = nil
+			case "only":
+				q.filter.Fork = github.Bool(true)
+			default:
+				return nil, fmt.Errorf("unsupported term %q", term)
+			}
+		case "is":
+			q.filter.Visibility = value
+		case "stars":
+			if !strings.HasPrefix(value, ">=") {
+				return nil, fmt.Errorf("unsupported term %q", term)
+			}
+			if q.filter.MinStars, err = strconv.Atoi(strings.TrimPrefix(value, ">=")); err != nil {
+				return nil, fmt.Errorf("bad term %q: %v", term, err)
+			}
+		case "pushed":
+			if !strings.HasPrefix(value, ">") {
+				return nil, fmt.Errorf("unsupported term %q", term)
+			}
+			if q.filter.PushedAfter, err = time.Parse(time.RFC3339, strings.TrimPrefix(value, ">")); err != nil {
+				return nil, fmt.Errorf("bad term %q: %v", term, err)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported term %q", term)
+		}
+	}
+	if q.owner == "" {
+		return nil, fmt.Errorf("query %q has no org or user", query)
+	}
+	return q, nil
+}
+
+// searchTerms splits a search query into its terms, where quoted values may
+// contain spaces, e.g. language:"Jupyter Notebook".
+func searchTerms(query string) ([]string, error) {
+	var terms []string
+	for query = strings.TrimSpace(query); query != ""; query = strings.TrimSpace(query) {
+		end := strings.IndexAny(query, " \"")
+		if end == -1 {
+			terms = append(terms, query)
+			break
+		}
+		if query[end] == ' ' {
+			terms = append(terms, query[:end])
+			query = query[end:]
+			continue
+		}
+		closing := strings.IndexByte(query[end+1:], '"')
+		if closing == -1 {
+			return nil, fmt.Errorf("unterminated quote in %q", query)
+		}
+		closing += end + 1
+		value, err := strconv.Unquote(query[end : closing+1])
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, query[:end]+value)
+		query = query[closing+1:]
+	}
+	return terms, nil
+}
+
+// parseSearchDate parses one end of a search date range, where "*" is
+// unbounded.
+func parseSearchDate(s string) (time.Time, error) {
+	if s == "*" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// NewRESTServer creates a fake GitHub REST API server that serves repos.
+func NewRESTServer(t testing.TB, repos []Repo, opts ...Option) *httptest.Server {
+	t.Helper()
+
+	o := newOptions(opts)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/search/repositories", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		q, err := parseRepoQuery(r.Form.Get("q"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		sorted := make([]*github.Repository, 0, len(repos))
+		// Like the real Search API, the qualifier must match the kind of owner.
+		if (q.qualifier == "user") == o.isUser(q.owner) {
+			for _, repo := range o.reposFor(q.owner, repos) {
+				if q.filter.Match(repo.attrs()) {
+					sorted = append(sorted, toGitHub(repo))
+				}
+			}
+		}
+
+		if s := r.Form.Get("sort"); s != "" {
+			var value func(r *github.Repository) int
+			switch s {
+			case "stars":
+				value = func(repo *github.Repository) int { return *repo.StargazersCount }
+			case "forks":
+				value = func(repo *github.Repository) int { return *repo.ForksCount }
+			}
+			if value != nil {
+				// Like the real Search API, results are in descending order
+				// unless asked for ascending.
+				asc := r.Form.Get("order") == "asc"
+				sort.SliceStable(sorted, func(i, j int) bool {
+					if asc {
+						return value(sorted[i]) < value(sorted[j])
+					}
+					return value(sorted[i]) > value(sorted[j])
+				})
+			}
+		}
+
+		// Like the real Search API, only the first 1,000 results are available
+		// even though the total count reflects every match.
+		available := sorted
+		if len(available) > searchLimit {
+			available = available[:searchLimit]
+		}
+
+		pageNum, _ := strconv.Atoi(r.Form.Get("page"))
+		perPage, _ := strconv.Atoi(r.Form.Get("per_page"))
+		start, end := page(len(available), pageNum, perPage)
+		setPageLinks(w, r, end, len(available), perPage)
+
+		writeJSON(t, w, &github.RepositoriesSearchResult{
+			Total:             github.Int(len(sorted)),
+			IncompleteResults: github.Bool(len(sorted) > searchLimit),
+			Repositories:      available[start:end],
+		})
+	})
+
+	// listRepos lists the owner's repos, which is the same for orgs and users.
+	listRepos := func(w http.ResponseWriter, r *http.Request, owner string) {
+		ownerRepos := o.reposFor(owner, repos)
+		q := r.URL.Query()
+		pageNum, _ := strconv.Atoi(q.Get("page"))
+		perPage, _ := strconv.Atoi(q.Get("per_page"))
+		start, end := page(len(ownerRepos), pageNum, perPage)
+		setPageLinks(w, r, end, len(ownerRepos), perPage)
+
+		result := make([]*github.Repository, 0, end-start)
+		for _, repo := range ownerRepos[start:end] {
+			result = append(result, toGitHub(repo))
+		}
+		writeJSON(t, w, result)
+	}
+
+	router.HandleFunc("/orgs/{org}/repos", func(w http.ResponseWriter, r *http.Request) {
+		org := mux.Vars(r)["org"]
+		if o.isUser(org) {
+			http.NotFound(w, r)
+			return
+		}
+		listRepos(w, r, org)
+	})
+
+	router.HandleFunc("/users/{user}/repos", func(w http.ResponseWriter, r *http.Request) {
+		user := mux.Vars(r)["user"]
+		if !o.isUser(user) {
+			http.NotFound(w, r)
+			return
+		}
+		listRepos(w, r, user)
+	})
+
+	// findRepo returns the repo for the request's owner and repo path variables.
+	findRepo := func(r *http.Request) (Repo, bool) {
+		vars := mux.Vars(r)
+		for _, repo := range o.reposFor(vars["owner"], repos) {
+			if repo.Name == vars["repo"] {
+				return repo, true
+			}
+		}
+		return Repo{}, false
+	}
+
+	router.HandleFunc("/search/issues", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		q, err := parseIssuesQuery(r.Form.Get("q"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		var repo Repo
+		for _, candidate := range o.reposFor(q.owner, repos) {
+			if candidate.Name == q.repo {
+				repo = candidate
+			}
+		}
+		total := 0
+		for _, at := range q.times(repo) {
+			if q.window.Contains(at) {
+				total++
+			}
+		}
+
+		// The TopN tool only looks at the total count, so no items are returned.
+		writeJSON(t, w, &github.IssuesSearchResult{
+			Total:             github.Int(total),
+			IncompleteResults: github.Bool(false),
+			Issues:            []*github.Issue{},
+		})
+	})
+
+	router.HandleFunc("/repos/{owner}/{repo}/stargazers", func(w http.ResponseWriter, r *http.Request) {
+		repo, _ := findRepo(r)
+		q := r.URL.Query()
+		pageNum, _ := strconv.Atoi(q.Get("page"))
+		perPage, _ := strconv.Atoi(q.Get("per_page"))
+		start, end := page(len(repo.StarredAt), pageNum, perPage)
+		setPageLinks(w, r, end, len(repo.StarredAt), perPage)
+
+		// Like the real API, stargazers are listed oldest first.
+		result := make([]*github.Stargazer, 0, end-start)
+		for _, at := range repo.StarredAt[start:end] {
+			result = append(result, &github.Stargazer{
+				StarredAt: &github.Timestamp{Time: at},
+				User:      &github.User{},
+			})
+		}
+		writeJSON(t, w, result)
+	})
+
+	router.HandleFunc("/repos/{owner}/{repo}/forks", func(w http.ResponseWriter, r *http.Request) {
+		repo, _ := findRepo(r)
+		q := r.URL.Query()
+		// The TopN tool always lists the newest forks first.
+		if s := q.Get("sort"); s != "newest" {
+			http.Error(w, fmt.Sprintf("unsupported sort %q", s), http.StatusBadRequest)
+			return
+		}
+		forked := append([]time.Time(nil), repo.ForkedAt...)
+		sort.Slice(forked, func(i, j int) bool { return forked[i].After(forked[j]) })
+
+		pageNum, _ := strconv.Atoi(q.Get("page"))
+		perPage, _ := strconv.Atoi(q.Get("per_page"))
+		start, end := page(len(forked), pageNum, perPage)
+		setPageLinks(w, r, end, len(forked), perPage)
+
+		result := make([]*github.Repository, 0, end-start)
+		for _, at := range forked[start:end] {
+			result = append(result, &github.Repository{CreatedAt: &github.Timestamp{Time: at}})
+		}
+		writeJSON(t, w, result)
+	})
+
+	router.HandleFunc("/repos/{owner}/{repo}", func(w http.ResponseWriter, r *http.Request) {
+		repo, ok := findRepo(r)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		full := toGitHub(repo)
+		full.SubscribersCount = github.Int(repo.Watchers)
+		writeJSON(t, w, full)
+	})
+
+	router.HandleFunc("/repos/{owner}/{repo}/pulls", func(w http.ResponseWriter, r *http.Request) {
+		repo, _ := findRepo(r)
+		count := repo.PRs
+		if r.URL.Query().Get("state") == "open" {
+			count = repo.OpenPRs
+		}
+		writeCount(t, w, r, count)
+	})
+
+	router.HandleFunc("/repos/{owner}/{repo}/releases", func(w http.ResponseWriter, r *http.Request) {
+		repo, _ := findRepo(r)
+		writeCount(t, w, r, repo.Releases)
+	})
+
+	router.HandleFunc("/repos/{owner}/{repo}/contributors", func(w http.ResponseWriter, r *http.Request) {
+		repo, _ := findRepo(r)
+		writeCount(t, w, r, repo.Contributors)
+	})
+
+	router.HandleFunc("/repos/{owner}/{repo}/commits", func(w http.ResponseWriter, r *http.Request) {
+		repo, _ := findRepo(r)
+		if repo.Commits == 0 {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"message": "Git Repository is empty."}`)
+			return
+		}
+		writeCount(t, w, r, repo.Commits)
+	})
+
+	var handler http.Handler = rateLimit(delay(router, o.latency), o.rateLimited, restRateLimited)
+	if o.app != nil {
+		router.HandleFunc("/app/installations/{id}/access_tokens", o.app.accessTokens)
+		handler = o.app.authenticate(handler)
+	}
+	apiHandler := http.NewServeMux()
+	apiHandler.Handle("/", handler)
+
+	return o.serve(apiHandler, "/api/v3")
+}
+
+// graphQLRequest is the body of a GraphQL API request.
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLTotalCount struct {
+	TotalCount int `json:"totalCount"`
+}
+
+// graphQLRepo is the JSON shape of a GraphQL Repository object.
+type graphQLRepo struct {
+	Name             string            `json:"name"`
+	StargazerCount   int               `json:"stargazerCount"`
+	ForkCount        int               `json:"forkCount"`
+	PullRequests     graphQLTotalCount `json:"pullRequests"`
+	Issues           graphQLTotalCount `json:"issues"`
+	Watchers         graphQLTotalCount `json:"watchers"`
+	Releases         graphQLTotalCount `json:"releases"`
+	DefaultBranchRef *struct {
+		Target struct {
+			History graphQLTotalCount `json:"history"`
+		} `json:"target"`
+	} `json:"defaultBranchRef"`
+	DiskUsage int `json:"diskUsage"`
+
+	PrimaryLanguage *struct {
+		Name string `json:"name"`
+	} `json:"primaryLanguage"`
+	RepositoryTopics *graphQLTopics `json:"repositoryTopics,omitempty"`
+	IsArchived       bool           `json:"isArchived"`
+	IsFork           bool           `json:"isFork"`
+	IsMirror         bool           `json:"isMirror"`
+	Visibility       string         `json:"visibility"`
+	PushedAt         *time.Time     `json:"pushedAt"`
+
+	PRsOpened    *graphQLConn `json:"prsOpened,omitempty"`
+	PRsMerged    *graphQLConn `json:"prsMerged,omitempty"`
+	IssuesOpened *graphQLConn `json:"issuesOpened,omitempty"`
+	StarsGained  *graphQLConn `json:"starsGained,omitempty"`
+	ForksGained  *graphQLConn `json:"forksGained,omitempty"`
+}
+
+// graphQLTopics is the JSON shape of a repo's topics connection.
+type graphQLTopics struct {
+	Nodes []graphQLTopic `json:"nodes"`
+}
+
+type graphQLTopic struct {
+	Topic struct {
+		Name string `json:"name"`
+	} `json:"topic"`
+}
+
+type graphQLPageInfo struct {
+	EndCursor   string `json:"endCursor"`
+	HasNextPage bool   `json:"hasNextPage"`
+}
+
+// graphQLConn is the JSON shape of a connection of timestamped items, such as
+// a repo's PRs, ordered newest first.
+type graphQLConn struct {
+	Nodes    []map[string]time.Time `json:"nodes,omitempty"`
+	Edges    []map[string]time.Time `json:"edges,omitempty"`
+	PageInfo graphQLPageInfo        `json:"pageInfo"`
+}
+
+// graphQLRateLimit is the JSON shape of the GraphQL RateLimit object.
+type graphQLRateLimit struct {
+	Cost      int       `json:"cost"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt"`
+}
+
+// graphQLBudget is a fake GraphQL API rate limit of 5,000 points an hour.
+type graphQLBudget struct {
+	mu        sync.Mutex
+	remaining int
+	resetAt   time.Time
+}
+
+func newGraphQLBudget() *graphQLBudget {
+	return &graphQLBudget{remaining: 5000, resetAt: time.Now().Add(time.Hour).Truncate(time.Second)}
+}
+
+// charge spends the points a query costs, unless it's a dry run, which only
+// calculates the cost.
+func (b *graphQLBudget) charge(cost int, dryRun bool) *graphQLRateLimit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !dryRun {
+		b.remaining -= cost
+	}
+	return &graphQLRateLimit{Cost: cost, Remaining: b.remaining, ResetAt: b.resetAt}
+}
+
+// queryCost returns the points a query for a page of repos costs. GitHub adds
+// up the requests needed to fulfill each connection, assuming every one is
+// full, and charges a point per 100 of them but at least one. Each of the 100
+// repos on a page needs a request for every nested connection, so a page costs
+// a point per nested connection.
+func queryCost(vars map[string]interface{}) int {
+	cost := 0
+	for _, name := range []string{"withTopics", "withPRsOpened", "withPRsMerged", "withIssuesOpened", "withStarsGained", "withForksGained"} {
+		if v, _ := vars[name].(bool); v {
+			cost++
+		}
+	}
+	if cost == 0 {
+		return 1
+	}
+	return cost
+}
+
+// timeline is a repo's items ordered newest first, where each item has the
+// timestamps for its fields.
+type timeline []map[string]time.Time
+
+// newTimeline returns the items ordered by the field, newest first.
+func newTimeline(items []map[string]time.Time, field string) timeline {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i][field].After(items[j][field])
+	})
+	return items
+}
+
+// page returns the connection with up to 100 items after the cursor, which is
+// the index of the next item to return. Items are returned as edges rather than
+// nodes if asEdges is set.
+func (tl timeline) page(cursor string, asEdges bool) (*graphQLConn, error) {
+	start := 0
+	if cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil {
+			return nil, fmt.Errorf("bad cursor %q", cursor)
+		}
+	}
+	if start > len(tl) {
+		start = len(tl)
+	}
+	// The TopN tool always pages by 100.
+	end := start + 100
+	if end > len(tl) {
+		end = len(tl)
+	}
+
+	conn := &graphQLConn{}
+	if asEdges {
+		conn.Edges = tl[start:end]
+	} else {
+		conn.Nodes = tl[start:end]
+	}
+	conn.PageInfo.EndCursor = strconv.Itoa(end)
+	conn.PageInfo.HasNextPage = end < len(tl)
+	return conn, nil
+}
+
+// windowed sets the connections for windowed metrics in r that are included by
+// the request's variables, starting after the "after" cursor.
+func windowed(r Repo, node *graphQLRepo, vars map[string]interface{}) error {
+	after, _ := vars["after"].(string)
+	include := func(name string) bool {
+		v, _ := vars[name].(bool)
+		return v
+	}
+
+	var err error
+	if include("withPRsOpened") {
+		var items []map[string]time.Time
+		for _, pull := range r.Pulls {
+			items = append(items, map[string]time.Time{"createdAt": pull.Created})
+		}
+		if node.PRsOpened, err = newTimeline(items, "createdAt").page(after, false); err != nil {
+			return err
+		}
+	}
+	if include("withPRsMerged") {
+		var items []map[string]time.Time
+		for _, pull := range r.Pulls {
+			if !pull.Merged.IsZero() {
+				// Merging a PR is the last time it's updated.
+				items = append(items, map[string]time.Time{"mergedAt": pull.Merged, "updatedAt": pull.Merged})
+			}
+		}
+		if node.PRsMerged, err = newTimeline(items, "updatedAt").page(after, false); err != nil {
+			return err
+		}
+	}
+	if include("withIssuesOpened") {
+		var items []map[string]time.Time
+		for _, created := range r.IssuesCreated {
+			items = append(items, map[string]time.Time{"createdAt": created})
+		}
+		if node.IssuesOpened, err = newTimeline(items, "createdAt").page(after, false); err != nil {
+			return err
+		}
+	}
+	if include("withStarsGained") {
+		var items []map[string]time.Time
+		for _, starred := range r.StarredAt {
+			items = append(items, map[string]time.Time{"starredAt": starred})
+		}
+		// starredAt is on the stargazer edge rather than the user node.
+		if node.StarsGained, err = newTimeline(items, "starredAt").page(after, true); err != nil {
+			return err
+		}
+	}
+	if include("withForksGained") {
+		var items []map[string]time.Time
+		for _, forked := range r.ForkedAt {
+			items = append(items, map[string]time.Time{"createdAt": forked})
+		}
+		if node.ForksGained, err = newTimeline(items, "createdAt").page(after, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toGraphQL converts r to a GraphQL Repository object, with its topics if the
+// request's variables include them.
+func toGraphQL(r Repo, vars map[string]interface{}) graphQLRepo {
+	node := graphQLRepo{
+		Name:           r.Name,
+		StargazerCount: r.Stars,
+		ForkCount:      r.Forks,
+		PullRequests:   graphQLTotalCount{r.PRs},
+		Issues:         graphQLTotalCount{r.OpenIssues},
+		Watchers:       graphQLTotalCount{r.Watchers},
+		Releases:       graphQLTotalCount{r.Releases},
+		DiskUsage:      r.Size,
+		IsArchived:     r.Archived,
+		IsFork:         r.Fork,
+		IsMirror:       r.Mirror,
+		Visibility:     strings.ToUpper(r.visibility()),
+	}
+	if r.Language != "" {
+		node.PrimaryLanguage = &struct {
+			Name string `json:"name"`
+		}{r.Language}
+	}
+	if !r.PushedAt.IsZero() {
+		node.PushedAt = &r.PushedAt
+	}
+	if withTopics, _ := vars["withTopics"].(bool); withTopics {
+		node.RepositoryTopics = &graphQLTopics{Nodes: []graphQLTopic{}}
+		for _, name := range r.Topics {
+			var topic graphQLTopic
+			topic.Topic.Name = name
+			node.RepositoryTopics.Nodes = append(node.RepositoryTopics.Nodes, topic)
+		}
+	}
+	// Empty repos have no default branch.
+	if r.Commits > 0 {
+		node.DefaultBranchRef = &struct {
+			Target struct {
+				History graphQLTotalCount `json:"history"`
+			} `json:"target"`
+		}{}
+		node.DefaultBranchRef.Target.History.TotalCount = r.Commits
+	}
+	return node
+}
+
+// NewGraphQLServer creates a fake GitHub GraphQL API server that serves repos
+// through the repository owner's repositories connection, and single repos for
+// paging through windowed metrics. Cursors are the index of the next item to
+// return. Every query returns its rate limit cost, and dry runs only return
+// that.
+func NewGraphQLServer(t testing.TB, repos []Repo, opts ...Option) *httptest.Server {
+	t.Helper()
+
+	o := newOptions(opts)
+	budget := newGraphQLBudget()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		login, _ := req.Variables["login"].(string)
+		var orgRepos []Repo
+		for _, repo := range o.reposFor(login, repos) {
+			if isFork, ok := req.Variables["isFork"].(bool); ok && repo.Fork != isFork {
+				continue
+			}
+			orgRepos = append(orgRepos, repo)
+		}
+
+		if dryRun, _ := req.Variables["dryRun"].(bool); dryRun {
+			var result struct {
+				Data struct {
+					RateLimit *graphQLRateLimit `json:"rateLimit"`
+				} `json:"data"`
+			}
+			result.Data.RateLimit = budget.charge(queryCost(req.Variables), true)
+			writeJSON(t, w, &result)
+			return
+		}
+
+		// Queries for a single repo are only used to page through windowed
+		// metrics.
+		if name, ok := req.Variables["name"].(string); ok {
+			var result struct {
+				Data struct {
+					Repository *graphQLRepo      `json:"repository"`
+					RateLimit  *graphQLRateLimit `json:"rateLimit"`
+				} `json:"data"`
+			}
+			result.Data.RateLimit = budget.charge(1, false)
+			for _, repo := range orgRepos {
+				if repo.Name != name {
+					continue
+				}
+				node := toGraphQL(repo, req.Variables)
+				if err := windowed(repo, &node, req.Variables); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				result.Data.Repository = &node
+			}
+			writeJSON(t, w, &result)
+			return
+		}
+
+		// Only queries counting repos don't page through them.
+		if _, ok := req.Variables["cursor"]; !ok {
+			var result struct {
+				Data struct {
+					RepositoryOwner struct {
+						Repositories graphQLTotalCount `json:"repositories"`
+					} `json:"repositoryOwner"`
+					RateLimit *graphQLRateLimit `json:"rateLimit"`
+				} `json:"data"`
+			}
+			result.Data.RepositoryOwner.Repositories.TotalCount = len(orgRepos)
+			result.Data.RateLimit = budget.charge(1, false)
+			writeJSON(t, w, &result)
+			return
+		}
+
+		start := 0
+		if cursor, ok := req.Variables["cursor"].(string); ok {
+			var err error
+			if start, err = strconv.Atoi(cursor); err != nil {
+				http.Error(w, fmt.Sprintf("bad cursor %q", cursor), http.StatusBadRequest)
+				return
+			}
+		}
+		if start > len(orgRepos) {
+			start = len(orgRepos)
+		}
+		// The TopN tool always pages by 100.
+		end := start + 100
+		if end > len(orgRepos) {
+			end = len(orgRepos)
+		}
+
+		var result struct {
+			Data struct {
+				RepositoryOwner struct {
+					Repositories struct {
+						Nodes    []graphQLRepo `json:"nodes"`
+						PageInfo struct {
+							EndCursor   string `json:"endCursor"`
+							HasNextPage bool   `json:"hasNextPage"`
+						} `json:"pageInfo"`
+					} `json:"repositories"`
+				} `json:"repositoryOwner"`
+				RateLimit *graphQLRateLimit `json:"rateLimit"`
+			} `json:"data"`
+		}
+		result.Data.RateLimit = budget.charge(queryCost(req.Variables), false)
+		conn := &result.Data.RepositoryOwner.Repositories
+		conn.Nodes = []graphQLRepo{}
+		for _, repo := range orgRepos[start:end] {
+			node := toGraphQL(repo, req.Variables)
+			if err := windowed(repo, &node, req.Variables); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			conn.Nodes = append(conn.Nodes, node)
+		}
+		conn.PageInfo.EndCursor = strconv.Itoa(end)
+		conn.PageInfo.HasNextPage = end < len(orgRepos)
+
+		writeJSON(t, w, &result)
+	})
+
+	apiHandler := http.NewServeMux()
+	apiHandler.Handle("/", rateLimit(delay(router, o.latency), o.rateLimited, graphQLRateLimited))
+
+	return o.serve(apiHandler, "/api")
+}
+
+// BaseURL returns the URL of serv suitable for use as a REST client's BaseURL.
+func BaseURL(t testing.TB, serv *httptest.Server) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(serv.URL + "/")
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", serv.URL+"/", err)
+	}
+	return u
+}
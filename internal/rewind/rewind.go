@@ -0,0 +1,30 @@
+// Package rewind prepares requests to be sent again by transports that retry
+// them.
+package rewind
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrNoGetBody is returned by Request when the request has a body, but no way
+// to get a fresh copy of it.
+var ErrNoGetBody = errors.New("can't retry request whose body can't be rewound")
+
+// Request returns the request to send for the attempt, which needs a fresh copy
+// of the body after the first attempt.
+func Request(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, ErrNoGetBody
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
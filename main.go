@@ -3,127 +3,762 @@
 //
 // Usage:
 //   repon --pat=[YOUR_PAT] --org=netflix --n=10 --metric=stars
+//
+// To compare two snapshots stored with --store:
+//   repon diff --store=[DIR] --owner=netflix
+//
+// To serve the top-n repos of any organization or user over HTTP:
+//   repon serve --pat=[YOUR_PAT] --addr=:8080
+//
+// To export the metrics of an organization's repos to Prometheus:
+//   repon exporter --pat=[YOUR_PAT] --org=netflix --addr=:8080
 package main
 
 import (
 	"context"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/google/go-github/v33/github"
-	"github.com/shurcooL/githubv4"
+	"github.com/vtsao/repon/auth"
+	"github.com/vtsao/repon/format"
+	"github.com/vtsao/repon/ghclient"
+	"github.com/vtsao/repon/httpcache"
 	"github.com/vtsao/repon/repo"
 	"github.com/vtsao/repon/repoql"
+	"github.com/vtsao/repon/retry"
+	"github.com/vtsao/repon/store"
+	"github.com/vtsao/repon/topn"
 	"golang.org/x/oauth2"
 )
 
 var (
-	org    = flag.String("org", "", "required, the organization to get repos for")
+	org    = flag.String("org", "", "required unless --user is set, comma separated organizations to get repos for")
+	user   = flag.String("user", "", "comma separated user accounts to get repos for")
 	n      = flag.Int("n", 0, "required, the top n repos to get")
-	metric = flag.String("metric", "stars", `the metric to sort repos by, must be one of ["stars", "forks", "prs", "contribs"]`)
+	metric = flag.String("metric", "stars", fmt.Sprintf("the metric to sort repos by, must be one of %q", topn.MetricNames()))
+	order  = flag.String("order", string(topn.Descending), fmt.Sprintf("the order to rank repos in by --metric, must be one of %q; asc lists the bottom n repos", topn.Orders()))
+
+	since = flag.String("since", "", fmt.Sprintf("start of the time window for windowed metrics, as a date (2006-01-02) or RFC 3339 time; required for windowed metrics %q", windowedMetricNames()))
+	until = flag.String("until", "", "end of the time window for windowed metrics, as a date (2006-01-02) or RFC 3339 time, defaults to now")
+
+	weights     = flag.String("weights", "", `weights of the metrics that make up --metric=score, e.g. "stars=0.5,prs=0.3,forks=0.2"`)
+	weightsFile = flag.String("weights_file", "", `file with the weights of the metrics that make up --metric=score, with one "metric=weight" per line`)
+	normalize   = flag.String("normalize", "none", fmt.Sprintf("how to normalize each metric across the org before weighting it for --metric=score, must be one of %q", topn.Normalizations()))
+
+	language    = flag.String("language", "", `only rank repos whose primary language is this, e.g. "Go"`)
+	topic       = flag.String("topic", "", "only rank repos with this topic")
+	archived    = flag.String("archived", "", `"true" to only rank archived repos, "false" to leave them out, empty to rank both`)
+	fork        = flag.String("fork", "", `"true" to only rank forks, which are left out by default`)
+	mirror      = flag.String("mirror", "", `"true" to only rank mirrors, "false" to leave them out, empty to rank both`)
+	visibility  = flag.String("visibility", "", fmt.Sprintf("only rank repos with this visibility, must be one of %q", topn.Visibilities))
+	minStars    = flag.Int("min_stars", 0, "only rank repos with at least this many stars")
+	pushedAfter = flag.String("pushed_after", "", "only rank repos pushed to after this date (2006-01-02) or RFC 3339 time")
+
+	include      stringsFlag
+	exclude      stringsFlag
+	patternsFile = flag.String("patterns_file", "", `file of repo name glob patterns with one per line, where patterns starting with "!" are exclude patterns and the rest are include patterns`)
 
 	// See https://docs.github.com/en/free-pro-team@latest/github/authenticating-to-github/creating-a-personal-access-token
 	// for how to create one.
-	pat = flag.String("pat", "", "required, GitHub OAuth2 personal access token with repo scope")
+	// Tokens are resolved from --pat, --pat_file, GH_TOKEN, GITHUB_TOKEN and
+	// the gh CLI's config in that order, see auth.Token.
+	pat     = flag.String("pat", "", "comma separated GitHub OAuth2 personal access tokens with repo scope, requests are spread across them; prefer --pat_file or GH_TOKEN, which don't leak them into shell history")
+	patFile = flag.String("pat_file", "", "file containing GitHub OAuth2 personal access tokens with repo scope, one per line")
+
+	// See https://docs.github.com/en/free-pro-team@latest/developers/apps/authenticating-with-github-apps
+	// for how to authenticate as a GitHub App instead.
+	appID             = flag.Int64("app_id", 0, "ID of the GitHub App to authenticate as instead of --pat")
+	appInstallationID = flag.Int64("app_installation_id", 0, "ID of the GitHub App's installation on the org or user; required with --app_id")
+	appPrivateKey     = flag.String("app_private_key", "", "file with the GitHub App's PEM encoded private key; required with --app_id")
+
+	output   = flag.String("output", "text", fmt.Sprintf("the format to output repos in, must be one of %q", format.Formats()))
+	sections = flag.Bool("sections", false, "with multiple --org or --user, output the top n repos of each in its own section rather than one merged leaderboard")
+	storeDir = flag.String("store", "", "directory to append a snapshot of each owner's ranked repos and their metrics to, with a JSON Lines file per owner, to track them over time")
+
+	addr           = flag.String("addr", ":8080", "address repon serve and repon exporter listen on")
+	responseTTL    = flag.Duration("response_ttl", 5*time.Minute, "how long repon serve caches each response, 0 means responses aren't cached")
+	requestTimeout = flag.Duration("request_timeout", 2*time.Minute, "longest repon serve spends listing an owner's repos for a request, 0 means no limit")
+	maxN           = flag.Int("max_n", 100, "largest n repon serve accepts in a request, 0 means no limit")
+
+	refreshInterval = flag.Duration("refresh_interval", 5*time.Minute, "how often repon exporter refreshes the repos' metrics")
 
 	useGraphQL = flag.Bool("use_graphql", true, "whether to use GitHub's GraphQL API or the REST API")
+	dryRun     = flag.Bool("dry_run", false, "estimate how many pages of repos and GraphQL API rate limit points listing each owner's repos takes, without listing them; requires --use_graphql")
+
+	apiURL     = flag.String("api_url", "", `GitHub Enterprise Server REST API URL, e.g. "https://github.example.com/api/v3/"; defaults to github.com`)
+	graphQLURL = flag.String("graphql_url", "", `GitHub Enterprise Server GraphQL API URL, e.g. "https://github.example.com/api/graphql"; defaults to the one for --api_url`)
+	caBundle   = flag.String("ca_bundle", "", "file of PEM encoded certificates to trust along with the system's, for a GitHub Enterprise Server using its own certificate authority")
+
+	maxRetries   = flag.Int("max_retries", 3, "maximum number of times to retry a request that was rate limited by GitHub")
+	maxRetryWait = flag.Duration("max_retry_wait", 5*time.Minute, "longest to wait for a GitHub rate limit to reset before retrying a request, 0 means no limit")
 
-	fillPRsConcurrency = flag.Int("fill_prs_concurrency", 10, `number of concurrent calls to GitHub Issues REST API to count PRs per repo if using one of ["prs", "contribs"]; only applicable if --use_graph_ql=false`)
+	cacheDir    = flag.String("cache_dir", "", "directory to cache GitHub REST API responses in, defaults to repon in the user's cache directory")
+	cacheTTL    = flag.Duration("cache_ttl", 10*time.Minute, "how long cached GitHub REST API responses are used without checking they're still current; checking doesn't count against the rate limit")
+	cacheMaxAge = flag.Duration("cache_max_age", 7*24*time.Hour, "how long cached GitHub REST API responses are kept after they were last checked, 0 means they're kept forever")
+	noCache     = flag.Bool("no_cache", false, "don't cache GitHub REST API responses")
+
+	fillPRsConcurrency = flag.Int("fill_prs_concurrency", 10, `number of concurrent calls to GitHub REST API to count PRs, or any other metric that needs a request per repo; only applicable if --use_graph_ql=false`)
+	fillPRsRate        = flag.Float64("fill_prs_rate", 0, `maximum requests per second to GitHub REST API to count PRs, or any other metric that needs a request per repo, 0 means no limit; only applicable if --use_graph_ql=false`)
 )
 
-func validateFlags() {
-	if *org == "" {
+// window is the time window parsed from --since and --until.
+var window topn.Window
+
+// score is the composite score parsed from --weights or --weights_file and
+// --normalize, which is only set for --metric=score.
+var score *topn.Score
+
+func init() {
+	flag.Var(&include, "include", `only rank repos whose name matches this glob pattern, e.g. "repon-*"; may be repeated`)
+	flag.Var(&exclude, "exclude", `don't rank repos whose name matches this glob pattern, e.g. "*-archive"; may be repeated`)
+}
+
+// stringsFlag is a flag that may be repeated, collecting every value.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// filter is the filter parsed from --language, --topic, --archived, --fork,
+// --mirror, --visibility, --min_stars, --pushed_after, --include, --exclude
+// and --patterns_file.
+var filter topn.Filter
+
+// windowedMetricNames returns the names of the metrics that count activity in
+// the time window.
+func windowedMetricNames() []string {
+	var names []string
+	for _, m := range topn.Metrics() {
+		if m.Windowed {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// parseTime parses a time flag, which is either a date or an RFC 3339 time.
+// Dates are in UTC.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// validateFlags validates the flags for the command, which is empty when
+// listing repos. The owners, n and metric of repon serve come from each
+// request, so --since, --until and --weights apply to every request that needs
+// them.
+func validateFlags(command string) {
+	switch command {
+	case "serve":
+		validateServeFlags()
+	case "exporter":
+		validateExporterFlags()
+	default:
+		validateListFlags()
+	}
+	if *since != "" {
+		t, err := parseTime(*since)
+		if err != nil {
+			log.Fatalf("--since must be a date (2006-01-02) or RFC 3339 time: %v", err)
+		}
+		window.Since = t
+	}
+	if *until != "" {
+		t, err := parseTime(*until)
+		if err != nil {
+			log.Fatalf("--until must be a date (2006-01-02) or RFC 3339 time: %v", err)
+		}
+		// A date includes the whole day.
+		if !strings.Contains(*until, "T") {
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		window.Until = t
+	}
+	// Velocities are per day of the window, so it can't be empty.
+	if !window.Until.IsZero() && !window.Until.After(window.Since) {
+		log.Fatal("--until must be after --since")
+	}
+	if err := topn.Order(*order).Validate(); err != nil {
+		flag.PrintDefaults()
+		log.Fatalf("--order must be one of %q", topn.Orders())
+	}
+	parseFilter()
+	if !format.Supported(*output) {
+		flag.PrintDefaults()
+		log.Fatalf("--output must be one of %q", format.Formats())
+	}
+	if *graphQLURL == "" && *apiURL != "" {
+		u, err := ghclient.GraphQLURL(*apiURL)
+		if err != nil {
+			log.Fatalf("Invalid --api_url: %v", err)
+		}
+		*graphQLURL = u
+	}
+	if *dryRun && !*useGraphQL {
+		flag.PrintDefaults()
+		log.Fatal("--dry_run requires --use_graphql")
+	}
+	if *appID != 0 {
+		if *pat != "" || *patFile != "" {
+			flag.PrintDefaults()
+			log.Fatal("--pat and --pat_file can't be set with --app_id")
+		}
+		if *appInstallationID == 0 || *appPrivateKey == "" {
+			flag.PrintDefaults()
+			log.Fatal("--app_installation_id and --app_private_key are required with --app_id")
+		}
+	}
+}
+
+// validateListFlags validates the flags that choose which repos to list.
+func validateListFlags() {
+	if *org == "" && *user == "" {
 		flag.PrintDefaults()
-		log.Fatal("--org is required")
+		log.Fatal("--org or --user is required")
 	}
 	if *n == 0 {
 		flag.PrintDefaults()
 		log.Fatal("--n is required")
 	}
-	if m := *metric; m != "stars" && m != "forks" && m != "prs" && m != "contribs" {
+	m, ok := topn.LookupMetric(*metric)
+	if !ok {
+		flag.PrintDefaults()
+		log.Fatalf("--metric must be one of %q", topn.MetricNames())
+	}
+	if *metric == "score" {
+		score = parseScore()
+		// Each owner's scores are normalized across its own repos, so they can't
+		// be merged into one leaderboard.
+		if score.Relative() && len(splitList(*org))+len(splitList(*user)) > 1 && !*sections {
+			flag.PrintDefaults()
+			log.Fatalf("--metric=score with --normalize=%s requires --sections with multiple --org or --user", *normalize)
+		}
+	} else if *weights != "" || *weightsFile != "" {
+		flag.PrintDefaults()
+		log.Fatal("--weights and --weights_file only apply to --metric=score")
+	}
+	windowed := isWindowed(m)
+	if windowed && *since == "" {
+		flag.PrintDefaults()
+		log.Fatalf("--since is required for --metric=%s", *metric)
+	}
+	if !windowed && (*since != "" || *until != "") {
+		flag.PrintDefaults()
+		log.Fatalf("--since and --until only apply to windowed metrics %q", windowedMetricNames())
+	}
+}
+
+// validateServeFlags validates the flags for repon serve.
+func validateServeFlags() {
+	if *org != "" || *user != "" {
+		flag.PrintDefaults()
+		log.Fatal("--org and --user don't apply to repon serve, which gets the owner from each request")
+	}
+	if *dryRun || *storeDir != "" || *sections {
+		flag.PrintDefaults()
+		log.Fatal("--dry_run, --store and --sections don't apply to repon serve")
+	}
+	if *weights != "" || *weightsFile != "" {
+		score = parseScore()
+	}
+	if *until != "" && *since == "" {
+		flag.PrintDefaults()
+		log.Fatal("--until requires --since")
+	}
+}
+
+// validateExporterFlags validates the flags for repon exporter.
+func validateExporterFlags() {
+	if *org == "" && *user == "" {
+		flag.PrintDefaults()
+		log.Fatal("--org or --user is required")
+	}
+	if !*useGraphQL {
+		flag.PrintDefaults()
+		log.Fatal("repon exporter requires --use_graphql")
+	}
+	if *dryRun || *storeDir != "" || *sections {
+		flag.PrintDefaults()
+		log.Fatal("--dry_run, --store and --sections don't apply to repon exporter")
+	}
+	if *since != "" || *until != "" || *weights != "" || *weightsFile != "" {
+		flag.PrintDefaults()
+		log.Fatal("--since, --until, --weights and --weights_file don't apply to repon exporter, which exports stars, forks and pull requests")
+	}
+	if *refreshInterval <= 0 {
+		flag.PrintDefaults()
+		log.Fatal("--refresh_interval must be positive")
+	}
+}
+
+// isWindowed returns whether m counts activity in the time window. A score is
+// windowed if any of the metrics it's made of are.
+func isWindowed(m *topn.Metric) bool {
+	components, _ := topn.Components(m.Name, score)
+	for _, c := range components {
+		if cm, _ := topn.LookupMetric(c); cm.Windowed {
+			return true
+		}
+	}
+	return m.Windowed
+}
+
+// parseFilter parses the filter flags into filter.
+func parseFilter() {
+	filter.Language = *language
+	filter.Topic = *topic
+	filter.Archived = parseBool("archived", *archived)
+	filter.Fork = parseBool("fork", *fork)
+	filter.Mirror = parseBool("mirror", *mirror)
+	filter.Visibility = *visibility
+	filter.MinStars = *minStars
+	if *pushedAfter != "" {
+		t, err := parseTime(*pushedAfter)
+		if err != nil {
+			log.Fatalf("--pushed_after must be a date (2006-01-02) or RFC 3339 time: %v", err)
+		}
+		filter.PushedAfter = t
+	}
+	filter.Names = parseNames()
+	if err := filter.Validate(); err != nil {
+		flag.PrintDefaults()
+		log.Fatalf("Invalid filter: %v", err)
+	}
+}
+
+// parseNames returns the repo name patterns from --include, --exclude and
+// --patterns_file, or nil if there are none.
+func parseNames() *topn.Names {
+	in, ex := []string(include), []string(exclude)
+	if *patternsFile != "" {
+		f, err := os.Open(*patternsFile)
+		if err != nil {
+			log.Fatalf("Error opening --patterns_file: %v", err)
+		}
+		defer f.Close()
+		fileIn, fileEx, err := topn.ReadPatterns(f)
+		if err != nil {
+			log.Fatalf("Error reading --patterns_file: %v", err)
+		}
+		in, ex = append(in, fileIn...), append(ex, fileEx...)
+	}
+	if len(in) == 0 && len(ex) == 0 {
+		return nil
+	}
+
+	names, err := topn.CompileNames(in, ex)
+	if err != nil {
+		log.Fatalf("Invalid repo name patterns: %v", err)
+	}
+	return names
+}
+
+// parseBool parses an optional bool flag, where empty means unset.
+func parseBool(name, s string) *bool {
+	if s == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
 		flag.PrintDefaults()
-		log.Fatal(`--metric must be one of ["stars", "forks", "prs", "contribs"]`)
+		log.Fatalf("--%s must be true, false or empty: %v", name, err)
 	}
-	if *pat == "" {
+	return &b
+}
+
+// parseScore returns the composite score for --metric=score.
+func parseScore() *topn.Score {
+	if (*weights == "") == (*weightsFile == "") {
 		flag.PrintDefaults()
-		log.Fatal("--pat is required")
+		log.Fatal("exactly one of --weights or --weights_file is required for --metric=score")
 	}
+
+	var w map[string]float64
+	var err error
+	if *weights != "" {
+		w, err = topn.ParseWeights(*weights)
+	} else {
+		var f *os.File
+		if f, err = os.Open(*weightsFile); err != nil {
+			log.Fatalf("Error opening --weights_file: %v", err)
+		}
+		defer f.Close()
+		w, err = topn.ReadWeights(f)
+	}
+	if err != nil {
+		log.Fatalf("Error parsing weights: %v", err)
+	}
+
+	s := &topn.Score{Weights: w, Normalize: *normalize}
+	if err := s.Validate(); err != nil {
+		log.Fatalf("Invalid score: %v", err)
+	}
+	return s
+}
+
+// graphQLBackend lists repos with the GraphQL API, keeping a running total of
+// the rate limit points its queries cost.
+type graphQLBackend struct {
+	*repoql.TopN
+
+	mu    sync.Mutex
+	stats repoql.Stats
 }
 
-func repon(ctx context.Context, client *http.Client) {
-	topn := repo.TopN{
-		Client:             github.NewClient(client),
+func (b *graphQLBackend) List(ctx context.Context, org string, n int, metric string) ([]*topn.Repo, error) {
+	repos, stats, err := b.ListWithStats(ctx, org, n, metric)
+	b.mu.Lock()
+	b.stats.Add(stats)
+	b.mu.Unlock()
+	return repos, err
+}
+
+// Stats returns the rate limit points spent so far.
+func (b *graphQLBackend) Stats() repoql.Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// newBackend returns the Backend to list repos with based on --use_graphql,
+// for either orgs or users.
+func newBackend(client *http.Client, user bool) topn.Backend {
+	if *useGraphQL {
+		return &graphQLBackend{TopN: &repoql.TopN{Client: ghclient.NewGraphQL(client, *graphQLURL), Window: window, Score: score, Filter: filter, Order: topn.Order(*order)}}
+	}
+
+	restClient, err := ghclient.NewREST(client, *apiURL)
+	if err != nil {
+		log.Fatalf("Invalid --api_url: %v", err)
+	}
+	return &repo.TopN{
+		Client:             restClient,
+		User:               user,
 		FillPRsConcurrency: *fillPRsConcurrency,
+		FillPRsRate:        *fillPRsRate,
+		Window:             window,
+		Score:              score,
+		Filter:             filter,
+		Order:              topn.Order(*order),
+	}
+}
+
+// splitList splits a comma separated flag value, ignoring empty values.
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// backends returns the Backends to list the repos of orgs and users with.
+func backends(client *http.Client) (orgBackend, userBackend topn.Backend) {
+	if *useGraphQL {
+		log.Print("Using GitHub GraphQL API")
+	} else {
+		log.Print("Using GitHub REST API")
+	}
+
+	orgBackend = newBackend(client, false)
+	userBackend = orgBackend
+	// The GraphQL API lists repos the same way for orgs and users, so they
+	// share a backend and its running total of points spent.
+	if !*useGraphQL {
+		userBackend = newBackend(client, true)
+	}
+	return orgBackend, userBackend
+}
+
+// owners returns the owners from --org and --user, each with a Backend to list
+// their repos.
+func owners(client *http.Client) []topn.Owner {
+	orgBackend, userBackend := backends(client)
+	var result []topn.Owner
+	for _, login := range splitList(*org) {
+		result = append(result, topn.Owner{Login: login, Backend: orgBackend})
+	}
+	for _, login := range splitList(*user) {
+		result = append(result, topn.Owner{Login: login, Backend: userBackend})
+	}
+	return result
+}
+
+// statusf prints progress for humans. Only the text format is meant for humans,
+// so for other formats it's logged instead to keep stdout free of anything but
+// the repos.
+func statusf(f string, v ...interface{}) {
+	if *output == "text" {
+		fmt.Printf(f+"\n", v...)
+		return
+	}
+	log.Printf(f, v...)
+}
+
+// rank describes which end of the ranking is listed, based on --order.
+func rank() string {
+	if topn.Order(*order).Ascending() {
+		return "bottom"
+	}
+	return "top"
+}
+
+// backendName names the API repos are listed with, based on --use_graphql.
+func backendName() string {
+	if *useGraphQL {
+		return "graphql"
+	}
+	return "rest"
+}
+
+// storeSnapshots appends a snapshot of each owner's ranked repos to --store,
+// if it's set. The repos are in rank order for each owner.
+func storeSnapshots(start time.Time, owners []topn.Owner, repos []*topn.Repo) {
+	if *storeDir == "" {
+		return
 	}
+	byOwner := make(map[string][]*topn.Repo)
+	for _, r := range repos {
+		byOwner[r.Owner] = append(byOwner[r.Owner], r)
+	}
+	s := &store.Store{Dir: *storeDir}
+	// Every owner is listed with the same kind of backend.
+	measured := owners[0].Backend.Measured(*metric)
+	for _, owner := range owners {
+		ownerRepos := byOwner[owner.Login]
+		// A single owner's repos don't have Repo.Owner set.
+		if len(owners) == 1 {
+			ownerRepos = repos
+		}
+		snap := store.NewSnapshot(start, owner.Login, backendName(), *metric, topn.Order(*order), *n, measured, ownerRepos)
+		if err := s.Append(snap); err != nil {
+			log.Fatalf("Error storing snapshot of %q in --store: %v", owner.Login, err)
+		}
+	}
+}
+
+func repon(ctx context.Context, start time.Time, owners []topn.Owner) {
+	// A single owner's repos are listed as before, without an owner column.
+	if len(owners) == 1 {
+		owner := owners[0]
+		statusf("Listing %s %d repos for %q by %q...", rank(), *n, owner.Login, *metric)
+		repos, err := owner.Backend.List(ctx, owner.Login, *n, *metric)
+		if err != nil {
+			log.Fatalf("Error listing top %d repos for %q by %q: %v", *n, owner.Login, *metric, err)
+		}
+		storeSnapshots(start, owners, repos)
+
+		if err := format.Write(os.Stdout, *output, repos, *metric, owner.Backend.Measured(*metric)); err != nil {
+			log.Fatalf("Error writing repos as %q: %v", *output, err)
+		}
+		return
+	}
+
+	var logins []string
+	for _, owner := range owners {
+		logins = append(logins, owner.Login)
+	}
+	statusf("Listing %s %d repos for %q by %q...", rank(), *n, logins, *metric)
+	repos, err := topn.ListOwners(ctx, owners, *n, *metric)
+	if err != nil {
+		log.Fatalf("Error listing top %d repos by %q: %v", *n, *metric, err)
+	}
+	storeSnapshots(start, owners, repos)
 
-	fmt.Printf("Listing top %d repos for org %q by %q...\n", *n, *org, *metric)
-	repos, err := topn.List(ctx, *org, *n, *metric)
+	measured := owners[0].Backend.Measured(*metric)
+	if *sections {
+		err = format.WriteSections(os.Stdout, *output, repos, *metric, measured)
+	} else {
+		m, _ := topn.LookupMetric(*metric)
+		err = format.Write(os.Stdout, *output, topn.Top(repos, m, topn.Order(*order), *n), *metric, measured)
+	}
 	if err != nil {
-		log.Fatalf("Error listing top %d repos for org %q by %q: %v", *n, *org, *metric, err)
+		log.Fatalf("Error writing repos as %q: %v", *output, err)
+	}
+}
+
+// logStats logs the GraphQL API rate limit points spent listing the owners'
+// repos.
+func logStats(owners []topn.Owner) {
+	if len(owners) == 0 {
+		return
+	}
+	b, ok := owners[0].Backend.(*graphQLBackend)
+	if !ok {
+		return
+	}
+	s := b.Stats()
+	log.Printf("%d GraphQL queries cost %d rate limit points, %d points remaining until %s", s.Queries, s.Cost, s.Remaining, s.ResetAt.Local().Format(time.Kitchen))
+}
+
+// estimate prints the estimated cost of listing each owner's repos with the
+// GraphQL API, without listing them.
+func estimate(ctx context.Context, owners []topn.Owner) {
+	total := 0
+	var last *repoql.Estimate
+	for _, owner := range owners {
+		e, err := owner.Backend.(*graphQLBackend).Estimate(ctx, owner.Login, *metric)
+		if err != nil {
+			log.Fatalf("Error estimating cost of listing repos for %q by %q: %v", owner.Login, *metric, err)
+		}
+		fmt.Printf("%s: %d repos in %d pages of %d points each, %d points\n", owner.Login, e.Repos, e.Pages, e.PageCost, e.Cost)
+		total += e.Cost
+		last = e
+	}
+	if len(owners) > 1 {
+		fmt.Printf("Total: %d points\n", total)
+	}
+	if last != nil {
+		fmt.Printf("%d points remaining until %s\n", last.Remaining, last.ResetAt.Local().Format(time.Kitchen))
 	}
+	if m, _ := topn.LookupMetric(*metric); isWindowed(m) {
+		fmt.Println("Windowed metrics cost more for repos with over 100 items in their connections, which isn't included.")
+	}
+}
 
-	for i, r := range repos {
-		switch *metric {
-		case "stars":
-			fmt.Printf("%d) repo: %q, stars: %d\n", i+1, *r.Name, *r.StargazersCount)
-		case "forks":
-			fmt.Printf("%d) repo: %q, forks: %d\n", i+1, *r.Name, *r.ForksCount)
-		case "prs":
-			fmt.Printf("%d) repo: %q, pull requests: %d\n", i+1, *r.Name, r.PRs)
-		case "contribs":
-			var contrib float64
-			if forks := *r.ForksCount; forks > 0 {
-				contrib = float64(r.PRs) / float64(forks)
-			}
-			fmt.Printf("%d) repo: %q, contribution percentage: %.2f%%\n", i+1, *r.Name, contrib*100)
+// cacheTransport returns a transport that caches responses to requests made
+// with base in --cache_dir, unless --no_cache is set.
+func cacheTransport(base http.RoundTripper) http.RoundTripper {
+	if *noCache {
+		return base
+	}
+	dir := *cacheDir
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			log.Fatalf("Error finding cache directory, set --cache_dir or --no_cache: %v", err)
 		}
+		dir = filepath.Join(userDir, "repon")
 	}
+	return &httpcache.Transport{Base: base, Dir: dir, TTL: *cacheTTL, MaxAge: *cacheMaxAge}
 }
 
-func reponQL(ctx context.Context, client *http.Client) {
-	topn := repoql.TopN{Client: githubv4.NewClient(client)}
+// authTransport returns a transport that authenticates requests made with base,
+// either with a pool of personal access tokens or with installation tokens for
+// the GitHub App. Every token is added to redactor.
+func authTransport(base http.RoundTripper, redactor *auth.Redactor) http.RoundTripper {
+	if *appID == 0 {
+		// A single pool is shared by the REST and GraphQL clients, so requests
+		// from both are spread across the tokens.
+		return auth.NewPool(resolveTokens(redactor), base)
+	}
 
-	fmt.Printf("Listing top %d repos for org %q by %q...\n", *n, *org, *metric)
-	repos, err := topn.List(ctx, *org, *n, *metric)
+	b, err := ioutil.ReadFile(*appPrivateKey)
 	if err != nil {
-		log.Fatalf("Error listing top %d repos for org %q by %q: %v", *n, *org, *metric, err)
+		log.Fatalf("Error reading --app_private_key: %v", err)
+	}
+	key, err := auth.ParsePrivateKey(b)
+	if err != nil {
+		log.Fatalf("Error parsing --app_private_key: %v", err)
+	}
+	app := &auth.App{
+		ID:             *appID,
+		InstallationID: *appInstallationID,
+		Key:            key,
+		APIURL:         *apiURL,
+		Client:         &http.Client{Transport: base},
 	}
+	return &oauth2.Transport{Source: redactor.TokenSource(app.TokenSource()), Base: base}
+}
 
-	for i, r := range repos {
-		switch *metric {
-		case "stars":
-			fmt.Printf("%d) repo: %q, stars: %d\n", i+1, r.Name, r.StargazerCount)
-		case "forks":
-			fmt.Printf("%d) repo: %q, forks: %d\n", i+1, r.Name, r.ForkCount)
-		case "prs":
-			fmt.Printf("%d) repo: %q, pull requests: %d\n", i+1, r.Name, r.PullRequests.TotalCount)
-		case "contribs":
-			var contrib float64
-			if forks := r.ForkCount; forks > 0 {
-				contrib = float64(r.PullRequests.TotalCount) / float64(forks)
-			}
-			fmt.Printf("%d) repo: %q, contribution percentage: %.2f%%\n", i+1, r.Name, contrib*100)
+// resolveTokens returns the personal access tokens to authenticate with.
+func resolveTokens(redactor *auth.Redactor) []string {
+	t := &auth.Token{PAT: *pat, PATFile: *patFile}
+	// The gh CLI's config has a token for each host.
+	if *apiURL != "" {
+		u, err := url.Parse(*apiURL)
+		if err != nil {
+			log.Fatalf("Invalid --api_url: %v", err)
 		}
+		t.Host = u.Host
+	}
+
+	tokens, source, err := t.Resolve()
+	if err != nil {
+		flag.PrintDefaults()
+		log.Fatalf("Error resolving GitHub token: %v", err)
+	}
+	for _, token := range tokens {
+		redactor.Add(token)
 	}
+	log.Printf("Using %d GitHub token(s) from %s", len(tokens), source)
+	if source == "--pat" {
+		log.Print("Warning: --pat leaks the token into shell history and process listings, prefer --pat_file or GH_TOKEN")
+	}
+	return tokens
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		diffMain(os.Args[2:])
+		return
+	}
+
+	// repon serve and repon exporter take the same flags, apart from those
+	// choosing which repos to list.
+	args := os.Args[1:]
+	var command string
+	if len(args) > 0 && (args[0] == "serve" || args[0] == "exporter") {
+		command, args = args[0], args[1:]
+	}
+
 	start := time.Now()
 	ctx := context.Background()
-	flag.Parse()
-	validateFlags()
-	client := oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *pat}))
+	// Tokens are redacted from everything logged, including errors.
+	redactor := auth.NewRedactor(os.Stderr)
+	log.SetOutput(redactor)
+	flag.CommandLine.Parse(args)
+	for _, token := range splitList(*pat) {
+		redactor.Add(token)
+	}
+	validateFlags(command)
+	transport, err := ghclient.Transport(*caBundle)
+	if err != nil {
+		log.Fatalf("Error loading --ca_bundle: %v", err)
+	}
+	client := &http.Client{Transport: &retry.Transport{
+		// Rate limited responses aren't cached, so the cache is between retries
+		// and authentication.
+		Base:       cacheTransport(authTransport(transport, redactor)),
+		MaxRetries: *maxRetries,
+		MaxWait:    *maxRetryWait,
+	}}
 
-	if *useGraphQL {
-		log.Print("Using GitHub GraphQL API")
-		reponQL(ctx, client)
-	} else {
-		log.Print("Using GitHub REST API")
-		repon(ctx, client)
+	switch command {
+	case "serve":
+		serve(client)
+		return
+	case "exporter":
+		export(client)
+		return
+	}
+	o := owners(client)
+	if *dryRun {
+		estimate(ctx, o)
+		return
 	}
+	repon(ctx, start, o)
+	logStats(o)
 
-	fmt.Printf("Took %s\n", time.Since(start))
+	statusf("Took %s", time.Since(start))
 }
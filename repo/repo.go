@@ -5,76 +5,217 @@ package repo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
-	"sort"
+	"net/http"
+	"strings"
 
 	"github.com/google/go-github/v33/github"
+	"github.com/vtsao/repon/topn"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 )
 
-type repos []*Repo
+var _ topn.Backend = (*TopN)(nil)
 
-func (r repos) Len() int      { return len(r) }
-func (r repos) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+// searchLimit is the maximum number of results GitHub's Search API returns for
+// a single query.
+const searchLimit = 1000
 
-// Note that all of these sort in descending order, which is why the Less() is
-// reversed.
+// errSearchLimit is returned when an org has more repos than Search can return.
+var errSearchLimit = errors.New("search results exceed GitHub's 1,000 result limit")
 
-type byPRs struct{ repos }
-
-func (r byPRs) Less(i, j int) bool { return r.repos[i].PRs > r.repos[j].PRs }
+// ghRepo holds information about a GitHub repository along with additional
+// data about the repo if requested.
+type ghRepo struct {
+	*github.Repository
+	PRs int
+	// Metrics holds the values of additional metrics filled in for the repo.
+	Metrics map[string]float64
+}
 
-type byContribs struct{ repos }
+func (r *ghRepo) setMetric(name string, value float64) {
+	if r.Metrics == nil {
+		r.Metrics = make(map[string]float64)
+	}
+	r.Metrics[name] = value
+}
 
-func (r byContribs) Less(i, j int) bool {
-	var contribI float64
-	if forksI := *r.repos[i].ForksCount; forksI != 0 {
-		contribI = float64(r.repos[i].PRs) / float64(forksI)
+// toTopN converts r to the common result type shared by all backends, with the
+// metrics that were filled in.
+func (r *ghRepo) toTopN(metrics []string) *topn.Repo {
+	tr := &topn.Repo{
+		Name:    *r.Name,
+		Stars:   *r.StargazersCount,
+		Forks:   *r.ForksCount,
+		PRs:     r.PRs,
+		Metrics: r.Metrics,
 	}
-	var contribJ float64
-	if forksJ := *r.repos[j].ForksCount; forksJ != 0 {
-		contribJ = float64(r.repos[j].PRs) / float64(forksJ)
+	for _, metric := range metrics {
+		switch metric {
+		case "contribs":
+			tr.SetMetric("contribs", topn.Contribs(tr.PRs, tr.Forks))
+		case "size":
+			// Unlike other additional metrics, size is returned when listing repos.
+			tr.SetMetric("size", float64(r.GetSize()))
+		}
 	}
-	return contribI > contribJ
+	return tr
 }
 
-// Repo holds information about a GitHub repository along with additional data
-// about the repo if requested.
-type Repo struct {
-	*github.Repository
-	PRs int
+func toTopN(repos []*ghRepo, metrics []string) []*topn.Repo {
+	trs := make([]*topn.Repo, 0, len(repos))
+	for _, r := range repos {
+		trs = append(trs, r.toTopN(metrics))
+	}
+	return trs
+}
+
+// filler fills in a metric for a repo that isn't returned when listing repos.
+type filler func(t *TopN, ctx context.Context, org string, r *ghRepo) error
+
+// fillers are the metrics that need to be filled in for each repo with
+// additional requests.
+var fillers = map[string]filler{
+	"prs":          (*TopN).fillPRs,
+	"contribs":     (*TopN).fillContribs,
+	"issues":       (*TopN).fillIssues,
+	"watchers":     (*TopN).fillWatchers,
+	"releases":     (*TopN).fillReleases,
+	"contributors": (*TopN).fillContributors,
+	"commits":      (*TopN).fillCommits,
+	// Search counts issues and PRs in the window for us, but it has a much lower
+	// quota, so these may need a low FillPRsRate.
+	"prs_opened":    searchFiller("prs_opened", "is:pr", "created"),
+	"prs_merged":    searchFiller("prs_merged", "is:pr is:merged", "merged"),
+	"issues_opened": searchFiller("issues_opened", "is:issue", "created"),
+	"stars_gained":  (*TopN).fillStarsGained,
+	"forks_gained":  (*TopN).fillForksGained,
 }
 
 // TopN interfaces with the GitHub REST API to find the top-n GitHub repos in an
 // org based on a metric.
 type TopN struct {
-	Client             *github.Client
+	Client *github.Client
+	// User is whether List lists the repos of a user account rather than an
+	// organization.
+	User bool
+	// FillPRsConcurrency is the maximum number of concurrent requests made to
+	// fill in PRs, or any other metric that needs a request per repo.
 	FillPRsConcurrency int
+	// FillPRsRate is the maximum number of requests per second made to fill in
+	// PRs, or any other metric that needs a request per repo. Zero means there
+	// is no limit.
+	FillPRsRate float64
+	// Window is the time window windowed metrics, such as prs_opened, count
+	// activity in.
+	Window topn.Window
+	// Score is the composite score repos are ranked by for the "score" metric.
+	Score *topn.Score
+	// Filter restricts which repos are ranked.
+	Filter topn.Filter
+	// Order is the order repos are ranked in, descending if empty.
+	Order topn.Order
+}
+
+// Measured implements topn.Backend. Stars and forks are returned when listing
+// repos, while everything else takes more requests, so it's only filled in when
+// needed to rank repos by metric. PRs are only counted for contribs of repos
+// with forks, so they aren't measured for it.
+func (t *TopN) Measured(metric string) []string {
+	return topn.Measured([]string{"stars", "forks"}, metric, t.Score)
 }
 
-// List returns the top-n GitHub repos for the org by metric.
-func (t *TopN) List(ctx context.Context, org string, n int, metric string) ([]*Repo, error) {
+// List returns the top-n GitHub repos for the org, or user if User is set, by
+// metric.
+func (t *TopN) List(ctx context.Context, org string, n int, metric string) ([]*topn.Repo, error) {
+	m, ok := topn.LookupMetric(metric)
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", metric)
+	}
+	components, err := topn.Components(metric, t.Score)
+	if err != nil {
+		return nil, err
+	}
+
+	repos, err := t.search(ctx, org, n, metric)
+	if err == errSearchLimit {
+		// Search silently stops at 1,000 results, so for large orgs we need to list
+		// every repo instead and sort them ourselves.
+		if t.User {
+			repos, err = t.listByUser(ctx, org)
+		} else {
+			repos, err = t.listByOrg(ctx, org)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Because we can't search repos by metrics like PRs using GitHub's repo
+	// Search we need to fill them in for each repo and sort them to get the top
+	// n.
+	for _, component := range components {
+		if fill, ok := fillers[component]; ok {
+			if err := t.fill(ctx, org, repos, fill); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Search may have already sorted stars and forks for us, which is kept for
+	// ties since the sort is stable.
+	trs := toTopN(repos, components)
+	topn.SetVelocities(trs, components, t.Window)
+	if metric == "score" {
+		if err := t.Score.Set(trs); err != nil {
+			return nil, err
+		}
+	}
+	topn.Sort(trs, m, t.Order)
+
+	n = int(math.Min(float64(n), float64(len(trs))))
+	return trs[:n], nil
+}
+
+// search returns the repos in the org using GitHub's Search API. When sorting
+// by stars or forks, Search sorts for us in the order so only the top n repos
+// are returned.
+// errSearchLimit is returned if the org has more repos than Search can return.
+func (t *TopN) search(ctx context.Context, org string, n int, metric string) ([]*ghRepo, error) {
 	opts := &github.SearchOptions{
 		ListOptions: github.ListOptions{PerPage: 100},
 	}
 	if metric == "stars" || metric == "forks" {
 		opts.Sort = metric
-		opts.Order = "desc"
+		opts.Order = string(topn.Descending)
+		if t.Order.Ascending() {
+			opts.Order = string(topn.Ascending)
+		}
 	}
 
-	var repos []*Repo
+	query := strings.Join(append([]string{t.qualifier() + ":" + org}, t.Filter.Qualifiers()...), " ")
+	var repos []*ghRepo
 	nextPage := 0
 	for {
 		opts.ListOptions.Page = nextPage
-		result, resp, err := t.Client.Search.Repositories(ctx, "org:"+org, opts)
+		result, resp, err := t.Client.Search.Repositories(ctx, query, opts)
 		if err != nil {
 			return nil, err
 		}
+		if result.GetTotal() > searchLimit {
+			return nil, errSearchLimit
+		}
 
 		for _, r := range result.Repositories {
-			repos = append(repos, &Repo{Repository: r})
-			// Since Search already sorts stars and forks for us, we can return early
-			// here if we've reached n results.
+			// Search can't filter by name, so repos are filtered again before
+			// they count towards n.
+			if !t.Filter.Match(attrs(r)) {
+				continue
+			}
+			repos = append(repos, &ghRepo{Repository: r})
+			// Since Search already sorts stars and forks for us in the order, we can
+			// return early here if we've reached n results.
 			if (metric == "stars" || metric == "forks") && len(repos) == n {
 				return repos, nil
 			}
@@ -86,66 +227,332 @@ func (t *TopN) List(ctx context.Context, org string, n int, metric string) ([]*R
 		nextPage = resp.NextPage
 	}
 
-	// Because we can't search repos by PRs using GitHub's repo Search we need to
-	// fill in PRs for each repo and sort them to get the top n.
-	switch metric {
-	case "prs":
-		if err := t.fillPRs(ctx, org, repos, metric); err != nil {
-			return nil, err
+	return repos, nil
+}
+
+// qualifier returns the search qualifier for the owner of the repos listed.
+func (t *TopN) qualifier() string {
+	if t.User {
+		return "user"
+	}
+	return "org"
+}
+
+// attrs returns the attributes of r that are filtered on.
+func attrs(r *github.Repository) topn.Attrs {
+	// Visibility is only returned by GitHub Enterprise, which has internal repos.
+	visibility := r.GetVisibility()
+	if visibility == "" {
+		visibility = "public"
+		if r.GetPrivate() {
+			visibility = "private"
 		}
-		sort.Sort(byPRs{repos})
-	case "contribs":
-		if err := t.fillPRs(ctx, org, repos, metric); err != nil {
+	}
+	return topn.Attrs{
+		Name:       r.GetName(),
+		Language:   r.GetLanguage(),
+		Topics:     r.Topics,
+		Archived:   r.GetArchived(),
+		Fork:       r.GetFork(),
+		Mirror:     r.GetMirrorURL() != "",
+		Visibility: visibility,
+		Stars:      r.GetStargazersCount(),
+		PushedAt:   r.GetPushedAt().Time,
+	}
+}
+
+// listByOrg returns every repo in the org. Unlike search, it isn't subject to
+// Search's result limit, but it can't sort for us.
+func (t *TopN) listByOrg(ctx context.Context, org string) ([]*ghRepo, error) {
+	opts := &github.RepositoryListByOrgOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var repos []*ghRepo
+	for {
+		result, resp, err := t.Client.Repositories.ListByOrg(ctx, org, opts)
+		if err != nil {
 			return nil, err
 		}
-		sort.Sort(byContribs{repos})
+		for _, r := range result {
+			// Unlike Search, listing repos can't filter them.
+			if t.Filter.Match(attrs(r)) {
+				repos = append(repos, &ghRepo{Repository: r})
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
 	}
 
-	n = int(math.Min(float64(n), float64(len(repos))))
-	return repos[:n], nil
+	return repos, nil
 }
 
-func (t *TopN) fillPRs(ctx context.Context, org string, repos []*Repo, metric string) error {
-	for i := 0; i < len(repos); i += t.FillPRsConcurrency {
-		end := int(math.Min(float64(i+t.FillPRsConcurrency), float64(len(repos))))
-		g, ctx := errgroup.WithContext(ctx)
-		for _, repo := range repos[i:end] {
-			if !*repo.HasIssues {
-				continue
+// listByUser returns every repo owned by the user, like listByOrg does for
+// orgs.
+func (t *TopN) listByUser(ctx context.Context, user string) ([]*ghRepo, error) {
+	opts := &github.RepositoryListOptions{
+		Type:        "owner",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var repos []*ghRepo
+	for {
+		result, resp, err := t.Client.Repositories.List(ctx, user, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range result {
+			// Unlike Search, listing repos can't filter them.
+			if t.Filter.Match(attrs(r)) {
+				repos = append(repos, &ghRepo{Repository: r})
 			}
-			if metric == "contribs" && *repo.ForksCount == 0 {
-				continue
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+
+	return repos, nil
+}
+
+// fill fills in a metric for each repo, keeping up to FillPRsConcurrency
+// requests in flight at a time.
+func (t *TopN) fill(ctx context.Context, org string, repos []*ghRepo, f filler) error {
+	concurrency := t.FillPRsConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var limiter *rate.Limiter
+	if t.FillPRsRate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(t.FillPRsRate), concurrency)
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, concurrency)
+loop:
+	for _, repo := range repos {
+		// Wait for a free slot, which stops early if the context is canceled or
+		// another request failed.
+		select {
+		case sem <- struct{}{}:
+		case <-gctx.Done():
+			break loop
+		}
+		if limiter != nil {
+			if err := limiter.Wait(gctx); err != nil {
+				<-sem
+				break loop
 			}
+		}
+
+		repo := repo
+		g.Go(func() error {
+			defer func() { <-sem }()
+			return f(t, gctx, org, repo)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	// If we stopped early because the context was canceled, none of the requests
+	// may have failed, but not every repo was filled in.
+	return ctx.Err()
+}
+
+// total returns the total number of items in a list requested with a page size
+// of 1, given the response and the number of items returned.
+func total(resp *github.Response, n int) int {
+	// The total is just the number of pages unless there is only one page, then
+	// it might be 0 or 1.
+	if resp.LastPage == 0 {
+		return n
+	}
+	return resp.LastPage
+}
+
+func (t *TopN) fillPRs(ctx context.Context, org string, r *ghRepo) error {
+	// Limit to 1 per page so we only need to do one request to count the number
+	// of pages to get the total PRs for this repo.
+	opts := &github.PullRequestListOptions{
+		State:       "all",
+		ListOptions: github.ListOptions{PerPage: 1},
+	}
+	// PullRequests is used instead of Search, since it has a higher quota. We
+	// easily run into rate limits when using Search for orgs with lots of repos.
+	// Note that PRs exist regardless of whether the repo has issues enabled.
+	results, resp, err := t.Client.PullRequests.List(ctx, org, *r.Name, opts)
+	if err != nil {
+		return err
+	}
+	r.PRs = total(resp, len(results))
+	return nil
+}
+
+func (t *TopN) fillContribs(ctx context.Context, org string, r *ghRepo) error {
+	// Repos without forks have no contribution percentage, so there's no need to
+	// count their PRs.
+	if *r.ForksCount == 0 {
+		return nil
+	}
+	return t.fillPRs(ctx, org, r)
+}
+
+func (t *TopN) fillIssues(ctx context.Context, org string, r *ghRepo) error {
+	// The open issues count GitHub returns also includes open PRs, so we need to
+	// count those and subtract them.
+	opts := &github.PullRequestListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 1},
+	}
+	results, resp, err := t.Client.PullRequests.List(ctx, org, *r.Name, opts)
+	if err != nil {
+		return err
+	}
+	r.setMetric("issues", float64(r.GetOpenIssuesCount()-total(resp, len(results))))
+	return nil
+}
+
+func (t *TopN) fillWatchers(ctx context.Context, org string, r *ghRepo) error {
+	// Listing repos only returns the legacy watchers count, which is actually the
+	// number of stars, so we need to get the repo for its subscribers count.
+	full, _, err := t.Client.Repositories.Get(ctx, org, *r.Name)
+	if err != nil {
+		return err
+	}
+	r.setMetric("watchers", float64(full.GetSubscribersCount()))
+	return nil
+}
+
+func (t *TopN) fillReleases(ctx context.Context, org string, r *ghRepo) error {
+	results, resp, err := t.Client.Repositories.ListReleases(ctx, org, *r.Name, &github.ListOptions{PerPage: 1})
+	if err != nil {
+		return err
+	}
+	r.setMetric("releases", float64(total(resp, len(results))))
+	return nil
+}
+
+func (t *TopN) fillContributors(ctx context.Context, org string, r *ghRepo) error {
+	opts := &github.ListContributorsOptions{
+		ListOptions: github.ListOptions{PerPage: 1},
+	}
+	results, resp, err := t.Client.Repositories.ListContributors(ctx, org, *r.Name, opts)
+	if err != nil {
+		return err
+	}
+	r.setMetric("contributors", float64(total(resp, len(results))))
+	return nil
+}
+
+func (t *TopN) fillCommits(ctx context.Context, org string, r *ghRepo) error {
+	opts := &github.CommitsListOptions{
+		SHA:         r.GetDefaultBranch(),
+		ListOptions: github.ListOptions{PerPage: 1},
+	}
+	results, resp, err := t.Client.Repositories.ListCommits(ctx, org, *r.Name, opts)
+	// Listing commits for an empty repo is a conflict, rather than no commits.
+	if resp != nil && resp.StatusCode == http.StatusConflict {
+		r.setMetric("commits", 0)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.setMetric("commits", float64(total(resp, len(results))))
+	return nil
+}
 
-			repo := repo
-			g.Go(func() error {
-				// Limit to 1 per page so we only need to do one request to count the
-				// number of pages to get the total PRs for this repo.
-				opts := &github.PullRequestListOptions{
-					State:       "all",
-					ListOptions: github.ListOptions{PerPage: 1},
-				}
-				// PullRequests is used instead of Search, since it has a higher quota.
-				// We easily run into rate limits when using Search for orgs with lots
-				// of repos.
-				results, resp, err := t.Client.PullRequests.List(ctx, org, *repo.Name, opts)
-				if err != nil {
-					return err
-				}
-				// Number of PRs is just the number of pages unless there is only one
-				// page, then it might be 0 or 1.
-				repo.PRs = resp.LastPage
-				if resp.LastPage == 0 {
-					repo.PRs = len(results)
-				}
-
-				return nil
-			})
-		}
-		if err := g.Wait(); err != nil {
+// searchFiller returns a filler that sets the metric to the number of issues or
+// PRs in the repo matching the qualifiers, with the date field in the window.
+func searchFiller(metric, qualifiers, dateField string) filler {
+	return func(t *TopN, ctx context.Context, org string, r *ghRepo) error {
+		q := fmt.Sprintf("repo:%s/%s %s %s", org, *r.Name, qualifiers, t.Window.Qualifier(dateField))
+		opts := &github.SearchOptions{
+			ListOptions: github.ListOptions{PerPage: 1},
+		}
+		result, _, err := t.Client.Search.Issues(ctx, q, opts)
+		if err != nil {
 			return err
 		}
+		r.setMetric(metric, float64(result.GetTotal()))
+		return nil
+	}
+}
+
+func (t *TopN) fillStarsGained(ctx context.Context, org string, r *ghRepo) error {
+	if r.GetStargazersCount() == 0 {
+		r.setMetric("stars_gained", 0)
+		return nil
+	}
+
+	opts := &github.ListOptions{PerPage: 100}
+	first, resp, err := t.Client.Activity.ListStargazers(ctx, org, *r.Name, opts)
+	if err != nil {
+		return err
+	}
+
+	// Stargazers are listed oldest first, so we page backwards from the last page
+	// until we reach stars from before the window.
+	stars := 0
+	for page := resp.LastPage; ; page-- {
+		results := first
+		if page > 1 {
+			opts.Page = page
+			if results, _, err = t.Client.Activity.ListStargazers(ctx, org, *r.Name, opts); err != nil {
+				return err
+			}
+		}
+
+		for _, s := range results {
+			if t.Window.Contains(s.GetStarredAt().Time) {
+				stars++
+			}
+		}
+
+		if page <= 1 || len(results) == 0 || t.Window.Before(results[0].GetStarredAt().Time) {
+			break
+		}
+	}
+	r.setMetric("stars_gained", float64(stars))
+	return nil
+}
+
+func (t *TopN) fillForksGained(ctx context.Context, org string, r *ghRepo) error {
+	if r.GetForksCount() == 0 {
+		r.setMetric("forks_gained", 0)
+		return nil
 	}
 
+	opts := &github.RepositoryListForksOptions{
+		Sort:        "newest",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	forks := 0
+	for {
+		results, resp, err := t.Client.Repositories.ListForks(ctx, org, *r.Name, opts)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range results {
+			if t.Window.Contains(f.GetCreatedAt().Time) {
+				forks++
+			}
+		}
+
+		// Forks are listed newest first, so once the oldest fork on the page is
+		// from before the window there's no need to look further.
+		if resp.NextPage == 0 || len(results) == 0 || t.Window.Before(results[len(results)-1].GetCreatedAt().Time) {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	r.setMetric("forks_gained", float64(forks))
 	return nil
 }
@@ -2,189 +2,55 @@ package repo_test
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"net/http/httptest"
-	"net/url"
-	"sort"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/go-github/v33/github"
-	"github.com/gorilla/mux"
+	"github.com/vtsao/repon/internal/fakegithub"
 	"github.com/vtsao/repon/repo"
+	"github.com/vtsao/repon/retry"
+	"github.com/vtsao/repon/topn"
 )
 
-// fakeGitHubAPIServ creates a fake GitHub REST API server that returns results
-// from a hardcoded set of repositories.
-func fakeGitHubAPIServ(t *testing.T) *httptest.Server {
-	t.Helper()
-
-	router := mux.NewRouter()
-	router.HandleFunc("/search/repositories", func(w http.ResponseWriter, r *http.Request) {
-		result := &github.RepositoriesSearchResult{
-			Total: github.Int(7),
-			Repositories: []*github.Repository{
-				{
-					Name:            github.String("security_monkey"),
-					StargazersCount: github.Int(10047),
-					ForksCount:      github.Int(792),
-					HasIssues:       github.Bool(true),
-				},
-				{
-					Name:            github.String("metaflow"),
-					StargazersCount: github.Int(20787),
-					ForksCount:      github.Int(2963),
-					HasIssues:       github.Bool(true),
-				},
-				{
-					Name:            github.String("SimianArmy"),
-					StargazersCount: github.Int(0),
-					ForksCount:      github.Int(4253),
-					HasIssues:       github.Bool(true),
-				},
-				{
-					Name:            github.String("chaosmonkey"),
-					StargazersCount: github.Int(1),
-					ForksCount:      github.Int(1017),
-					HasIssues:       github.Bool(true),
-				},
-				{
-					Name:            github.String("zuul"),
-					StargazersCount: github.Int(0),
-					ForksCount:      github.Int(0),
-					HasIssues:       github.Bool(true),
-				},
-				{
-					Name:            github.String("Hystrix"),
-					StargazersCount: github.Int(10248),
-					ForksCount:      github.Int(728),
-					HasIssues:       github.Bool(true),
-				},
-				{
-					Name:            github.String("boqboqboq"),
-					StargazersCount: github.Int(64),
-					ForksCount:      github.Int(9),
-					HasIssues:       github.Bool(true),
-				},
-			},
-		}
-
-		r.ParseForm()
-
-		if s := r.Form.Get("sort"); s != "" {
-			switch s {
-			case "stars":
-				sort.Slice(result.Repositories, func(i, j int) bool {
-					return *result.Repositories[i].StargazersCount > *result.Repositories[j].StargazersCount
-				})
-			case "forks":
-				sort.Slice(result.Repositories, func(i, j int) bool {
-					return *result.Repositories[i].ForksCount > *result.Repositories[j].ForksCount
-				})
-			}
-		}
-
-		// We don't deal with pagination here b/c the TopN tool pages by 100 and we
-		// have < 100 fake repos. But ideally a fake should deal with pagination.
-
-		b, err := json.Marshal(result)
-		if err != nil {
-			t.Fatalf("Marshal(%+v) failed: %v", result, err)
-		}
-		w.Write(b)
-	})
-
-	router.HandleFunc("/repos/{owner}/{repo}/pulls", func(w http.ResponseWriter, r *http.Request) {
-		prCounts := map[string]int{
-			"security_monkey": 55,
-			"metaflow":        34555,
-			"SimianArmy":      39811,
-			"chaosmonkey":     1,
-			"zuul":            2305,
-			"Hystrix":         0,
-			"boqboqboq":       1,
-		}
-
-		prCount := prCounts[mux.Vars(r)["repo"]]
-
-		// Set response pagination headers.
-		if prCount > 0 {
-			// Since the TopN tool always pages by 1 and only looks at the last page
-			// to get the total PRs, this is the only page header we need to set.
-			q := r.URL.Query()
-			q.Set("page", fmt.Sprintf("%d", prCount))
-			r.URL.RawQuery = q.Encode()
-			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"last\"", r.URL))
-		}
-
-		// Marshal the response.
-		var prs []*github.PullRequest
-		if prCount > 0 {
-			// We only return one object here in this fake b/c the TopN tool always
-			// pages by 1 when listing PRs and we can return an empty object b/c the
-			// tool also doesn't care about the PR's contents, only the length.
-			prs = append(prs, &github.PullRequest{})
-		}
-		b, err := json.Marshal(prs)
-		if err != nil {
-			t.Fatalf("Marshal(%+v) failed: %v", prs, err)
-		}
-		w.Write(b)
-	})
-
-	apiHandler := http.NewServeMux()
-	apiHandler.Handle("/", router)
-
-	return httptest.NewServer(apiHandler)
-}
-
 func TestList(t *testing.T) {
 	ctx := context.Background()
 
-	serv := fakeGitHubAPIServ(t)
+	serv := fakegithub.NewRESTServer(t, fakegithub.Netflix())
+	defer serv.Close()
 	client := github.NewClient(nil)
-	url, err := url.Parse(serv.URL + "/")
-	if err != nil {
-		t.Fatalf("Parse(%q) failed: %v", serv.URL+"/", err)
-	}
-	client.BaseURL = url
+	client.BaseURL = fakegithub.BaseURL(t, serv)
 
 	tests := []struct {
 		desc               string
 		n                  int
 		metric             string
 		fillPRsConcurrency int
-		wantRepos          []*repo.Repo
+		wantRepos          []*topn.Repo
 	}{
 		{
 			desc:               "top-3 repos by stars",
 			n:                  3,
 			metric:             "stars",
 			fillPRsConcurrency: 1,
-			wantRepos: []*repo.Repo{
+			wantRepos: []*topn.Repo{
 				{
-					Repository: &github.Repository{
-						Name:            github.String("metaflow"),
-						StargazersCount: github.Int(20787),
-						ForksCount:      github.Int(2963),
-					},
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("Hystrix"),
-						StargazersCount: github.Int(10248),
-						ForksCount:      github.Int(728),
-					},
+					Name:  "Hystrix",
+					Stars: 10248,
+					Forks: 728,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("security_monkey"),
-						StargazersCount: github.Int(10047),
-						ForksCount:      github.Int(792),
-					},
+					Name:  "security_monkey",
+					Stars: 10047,
+					Forks: 792,
 				},
 			},
 		},
@@ -193,27 +59,21 @@ func TestList(t *testing.T) {
 			n:                  3,
 			metric:             "forks",
 			fillPRsConcurrency: 1,
-			wantRepos: []*repo.Repo{
+			wantRepos: []*topn.Repo{
 				{
-					Repository: &github.Repository{
-						Name:            github.String("SimianArmy"),
-						StargazersCount: github.Int(0),
-						ForksCount:      github.Int(4253),
-					},
+					Name:  "SimianArmy",
+					Stars: 0,
+					Forks: 4253,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("metaflow"),
-						StargazersCount: github.Int(20787),
-						ForksCount:      github.Int(2963),
-					},
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("chaosmonkey"),
-						StargazersCount: github.Int(1),
-						ForksCount:      github.Int(1017),
-					},
+					Name:  "chaosmonkey",
+					Stars: 1,
+					Forks: 1017,
 				},
 			},
 		},
@@ -222,30 +82,24 @@ func TestList(t *testing.T) {
 			n:                  3,
 			metric:             "prs",
 			fillPRsConcurrency: 1,
-			wantRepos: []*repo.Repo{
+			wantRepos: []*topn.Repo{
 				{
-					Repository: &github.Repository{
-						Name:            github.String("SimianArmy"),
-						StargazersCount: github.Int(0),
-						ForksCount:      github.Int(4253),
-					},
-					PRs: 39811,
+					Name:  "SimianArmy",
+					Stars: 0,
+					Forks: 4253,
+					PRs:   39811,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("metaflow"),
-						StargazersCount: github.Int(20787),
-						ForksCount:      github.Int(2963),
-					},
-					PRs: 34555,
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
+					PRs:   34555,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("zuul"),
-						StargazersCount: github.Int(0),
-						ForksCount:      github.Int(0),
-					},
-					PRs: 2305,
+					Name:  "zuul",
+					Stars: 0,
+					Forks: 0,
+					PRs:   2305,
 				},
 			},
 		},
@@ -254,30 +108,183 @@ func TestList(t *testing.T) {
 			n:                  3,
 			metric:             "contribs",
 			fillPRsConcurrency: 1,
-			wantRepos: []*repo.Repo{
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "metaflow",
+					Stars:   20787,
+					Forks:   2963,
+					PRs:     34555,
+					Metrics: map[string]float64{"contribs": 34555.0 / 2963},
+				},
+				{
+					Name:    "SimianArmy",
+					Stars:   0,
+					Forks:   4253,
+					PRs:     39811,
+					Metrics: map[string]float64{"contribs": 39811.0 / 4253},
+				},
+				{
+					Name:    "security_monkey",
+					Stars:   10047,
+					Forks:   792,
+					PRs:     55,
+					Metrics: map[string]float64{"contribs": 55.0 / 792},
+				},
+			},
+		},
+		{
+			desc:               "top-3 repos by issues",
+			n:                  3,
+			metric:             "issues",
+			fillPRsConcurrency: 1,
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "Hystrix",
+					Stars:   10248,
+					Forks:   728,
+					Metrics: map[string]float64{"issues": 300},
+				},
+				{
+					Name:    "metaflow",
+					Stars:   20787,
+					Forks:   2963,
+					Metrics: map[string]float64{"issues": 150},
+				},
+				{
+					Name:    "security_monkey",
+					Stars:   10047,
+					Forks:   792,
+					Metrics: map[string]float64{"issues": 20},
+				},
+			},
+		},
+		{
+			desc:               "top-3 repos by watchers",
+			n:                  3,
+			metric:             "watchers",
+			fillPRsConcurrency: 1,
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "zuul",
+					Stars:   0,
+					Forks:   0,
+					Metrics: map[string]float64{"watchers": 1200},
+				},
+				{
+					Name:    "Hystrix",
+					Stars:   10248,
+					Forks:   728,
+					Metrics: map[string]float64{"watchers": 1000},
+				},
+				{
+					Name:    "SimianArmy",
+					Stars:   0,
+					Forks:   4253,
+					Metrics: map[string]float64{"watchers": 700},
+				},
+			},
+		},
+		{
+			desc:               "top-3 repos by releases",
+			n:                  3,
+			metric:             "releases",
+			fillPRsConcurrency: 1,
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "zuul",
+					Stars:   0,
+					Forks:   0,
+					Metrics: map[string]float64{"releases": 90},
+				},
+				{
+					Name:    "metaflow",
+					Stars:   20787,
+					Forks:   2963,
+					Metrics: map[string]float64{"releases": 60},
+				},
+				{
+					Name:    "security_monkey",
+					Stars:   10047,
+					Forks:   792,
+					Metrics: map[string]float64{"releases": 40},
+				},
+			},
+		},
+		{
+			desc:               "top-3 repos by contributors",
+			n:                  3,
+			metric:             "contributors",
+			fillPRsConcurrency: 1,
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "security_monkey",
+					Stars:   10047,
+					Forks:   792,
+					Metrics: map[string]float64{"contributors": 120},
+				},
+				{
+					Name:    "zuul",
+					Stars:   0,
+					Forks:   0,
+					Metrics: map[string]float64{"contributors": 110},
+				},
+				{
+					Name:    "Hystrix",
+					Stars:   10248,
+					Forks:   728,
+					Metrics: map[string]float64{"contributors": 100},
+				},
+			},
+		},
+		{
+			desc:               "top-3 repos by commits",
+			n:                  3,
+			metric:             "commits",
+			fillPRsConcurrency: 1,
+			wantRepos: []*topn.Repo{
 				{
-					Repository: &github.Repository{
-						Name:            github.String("metaflow"),
-						StargazersCount: github.Int(20787),
-						ForksCount:      github.Int(2963),
-					},
-					PRs: 34555,
+					Name:    "zuul",
+					Stars:   0,
+					Forks:   0,
+					Metrics: map[string]float64{"commits": 3000},
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("SimianArmy"),
-						StargazersCount: github.Int(0),
-						ForksCount:      github.Int(4253),
-					},
-					PRs: 39811,
+					Name:    "security_monkey",
+					Stars:   10047,
+					Forks:   792,
+					Metrics: map[string]float64{"commits": 2400},
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("boqboqboq"),
-						StargazersCount: github.Int(64),
-						ForksCount:      github.Int(9),
-					},
-					PRs: 1,
+					Name:    "Hystrix",
+					Stars:   10248,
+					Forks:   728,
+					Metrics: map[string]float64{"commits": 2100},
+				},
+			},
+		},
+		{
+			desc:               "top-3 repos by size",
+			n:                  3,
+			metric:             "size",
+			fillPRsConcurrency: 1,
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "zuul",
+					Stars:   0,
+					Forks:   0,
+					Metrics: map[string]float64{"size": 30000},
+				},
+				{
+					Name:    "metaflow",
+					Stars:   20787,
+					Forks:   2963,
+					Metrics: map[string]float64{"size": 25000},
+				},
+				{
+					Name:    "Hystrix",
+					Stars:   10248,
+					Forks:   728,
+					Metrics: map[string]float64{"size": 12000},
 				},
 			},
 		},
@@ -286,13 +293,11 @@ func TestList(t *testing.T) {
 			n:                  1,
 			metric:             "stars",
 			fillPRsConcurrency: 1,
-			wantRepos: []*repo.Repo{
+			wantRepos: []*topn.Repo{
 				{
-					Repository: &github.Repository{
-						Name:            github.String("metaflow"),
-						StargazersCount: github.Int(20787),
-						ForksCount:      github.Int(2963),
-					},
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
 				},
 			},
 		},
@@ -301,55 +306,36 @@ func TestList(t *testing.T) {
 			n:                  9999,
 			metric:             "stars",
 			fillPRsConcurrency: 1,
-			wantRepos: []*repo.Repo{
+			wantRepos: []*topn.Repo{
 				{
-					Repository: &github.Repository{
-						Name:            github.String("metaflow"),
-						StargazersCount: github.Int(20787),
-						ForksCount:      github.Int(2963),
-					},
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("Hystrix"),
-						StargazersCount: github.Int(10248),
-						ForksCount:      github.Int(728),
-					},
+					Name:  "Hystrix",
+					Stars: 10248,
+					Forks: 728,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("security_monkey"),
-						StargazersCount: github.Int(10047),
-						ForksCount:      github.Int(792),
-					},
+					Name:  "security_monkey",
+					Stars: 10047,
+					Forks: 792,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("boqboqboq"),
-						StargazersCount: github.Int(64),
-						ForksCount:      github.Int(9),
-					},
+					Name:  "chaosmonkey",
+					Stars: 1,
+					Forks: 1017,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("chaosmonkey"),
-						StargazersCount: github.Int(1),
-						ForksCount:      github.Int(1017),
-					},
+					Name:  "SimianArmy",
+					Stars: 0,
+					Forks: 4253,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("SimianArmy"),
-						StargazersCount: github.Int(0),
-						ForksCount:      github.Int(4253),
-					},
-				},
-				{
-					Repository: &github.Repository{
-						Name:            github.String("zuul"),
-						StargazersCount: github.Int(0),
-						ForksCount:      github.Int(0),
-					},
+					Name:  "zuul",
+					Stars: 0,
+					Forks: 0,
 				},
 			},
 		},
@@ -358,27 +344,21 @@ func TestList(t *testing.T) {
 			n:                  3,
 			metric:             "stars",
 			fillPRsConcurrency: 10,
-			wantRepos: []*repo.Repo{
+			wantRepos: []*topn.Repo{
 				{
-					Repository: &github.Repository{
-						Name:            github.String("metaflow"),
-						StargazersCount: github.Int(20787),
-						ForksCount:      github.Int(2963),
-					},
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("Hystrix"),
-						StargazersCount: github.Int(10248),
-						ForksCount:      github.Int(728),
-					},
+					Name:  "Hystrix",
+					Stars: 10248,
+					Forks: 728,
 				},
 				{
-					Repository: &github.Repository{
-						Name:            github.String("security_monkey"),
-						StargazersCount: github.Int(10047),
-						ForksCount:      github.Int(792),
-					},
+					Name:  "security_monkey",
+					Stars: 10047,
+					Forks: 792,
 				},
 			},
 		},
@@ -386,15 +366,487 @@ func TestList(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.desc, func(t *testing.T) {
-			topn := repo.TopN{Client: client, FillPRsConcurrency: tt.fillPRsConcurrency}
-			repos, err := topn.List(ctx, "netflix", tt.n, tt.metric)
+			backend := repo.TopN{Client: client, FillPRsConcurrency: tt.fillPRsConcurrency}
+			repos, err := backend.List(ctx, "netflix", tt.n, tt.metric)
 			if err != nil {
 				t.Fatalf(`List("netflix", %d, %q) failed: %v`, tt.n, tt.metric, err)
 			}
 
-			if diff := cmp.Diff(tt.wantRepos, repos, cmpopts.IgnoreFields(github.Repository{}, "HasIssues")); diff != "" {
+			if diff := cmp.Diff(tt.wantRepos, repos); diff != "" {
 				t.Errorf("List(\"netflix\", %d, %q) got diff (-want +got):\n%s", tt.n, tt.metric, diff)
 			}
 		})
 	}
 }
+
+func TestListWindowed(t *testing.T) {
+	ctx := context.Background()
+
+	serv := fakegithub.NewRESTServer(t, fakegithub.Netflix())
+	defer serv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL = fakegithub.BaseURL(t, serv)
+	backend := repo.TopN{Client: client, FillPRsConcurrency: 10, Window: fakegithub.Q4}
+	days := fakegithub.Q4.Days()
+
+	tests := []struct {
+		metric    string
+		wantRepos []*topn.Repo
+	}{
+		{
+			metric: "prs_opened",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, Metrics: map[string]float64{"prs_opened": 5}},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, Metrics: map[string]float64{"prs_opened": 4}},
+				{Name: "zuul", Stars: 0, Forks: 0, Metrics: map[string]float64{"prs_opened": 3}},
+			},
+		},
+		{
+			metric: "prs_merged",
+			wantRepos: []*topn.Repo{
+				{Name: "zuul", Stars: 0, Forks: 0, Metrics: map[string]float64{"prs_merged": 4}},
+				{Name: "metaflow", Stars: 20787, Forks: 2963, Metrics: map[string]float64{"prs_merged": 3}},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, Metrics: map[string]float64{"prs_merged": 2}},
+			},
+		},
+		{
+			metric: "issues_opened",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, Metrics: map[string]float64{"issues_opened": 4}},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, Metrics: map[string]float64{"issues_opened": 3}},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, Metrics: map[string]float64{"issues_opened": 2}},
+			},
+		},
+		{
+			metric: "stars_gained",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, Metrics: map[string]float64{"stars_gained": 120}},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, Metrics: map[string]float64{"stars_gained": 4}},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, Metrics: map[string]float64{"stars_gained": 2}},
+			},
+		},
+		{
+			metric: "forks_gained",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, Metrics: map[string]float64{"forks_gained": 110}},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, Metrics: map[string]float64{"forks_gained": 2}},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, Metrics: map[string]float64{"forks_gained": 1}},
+			},
+		},
+		{
+			// Velocities come with the windowed metric they're derived from.
+			metric: "stars_velocity",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, Metrics: map[string]float64{"stars_gained": 120, "stars_velocity": 120 / days}},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, Metrics: map[string]float64{"stars_gained": 4, "stars_velocity": 4 / days}},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, Metrics: map[string]float64{"stars_gained": 2, "stars_velocity": 2 / days}},
+			},
+		},
+		{
+			metric: "forks_velocity",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, Metrics: map[string]float64{"forks_gained": 110, "forks_velocity": 110 / days}},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, Metrics: map[string]float64{"forks_gained": 2, "forks_velocity": 2 / days}},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, Metrics: map[string]float64{"forks_gained": 1, "forks_velocity": 1 / days}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			repos, err := backend.List(ctx, "netflix", 3, tt.metric)
+			if err != nil {
+				t.Fatalf(`List("netflix", 3, %q) failed: %v`, tt.metric, err)
+			}
+
+			if diff := cmp.Diff(tt.wantRepos, repos); diff != "" {
+				t.Errorf("List(\"netflix\", 3, %q) got diff (-want +got):\n%s", tt.metric, diff)
+			}
+		})
+	}
+}
+
+func TestListScore(t *testing.T) {
+	serv := fakegithub.NewRESTServer(t, fakegithub.Netflix())
+	defer serv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL = fakegithub.BaseURL(t, serv)
+	backend := repo.TopN{
+		Client:             client,
+		FillPRsConcurrency: 10,
+		Score:              &topn.Score{Weights: map[string]float64{"stars": 1, "forks": 1}, Normalize: "minmax"},
+	}
+
+	repos, err := backend.List(context.Background(), "netflix", 3, "score")
+	if err != nil {
+		t.Fatalf(`List("netflix", 3, "score") failed: %v`, err)
+	}
+
+	// Stars and forks are normalized by the most stars (metaflow) and forks
+	// (SimianArmy) in the org.
+	wantRepos := []*topn.Repo{
+		{Name: "metaflow", Stars: 20787, Forks: 2963, Metrics: map[string]float64{"score": 1 + 2963.0/4253}},
+		{Name: "SimianArmy", Stars: 0, Forks: 4253, Metrics: map[string]float64{"score": 1}},
+		{Name: "security_monkey", Stars: 10047, Forks: 792, Metrics: map[string]float64{"score": 10047.0/20787 + 792.0/4253}},
+	}
+	if diff := cmp.Diff(wantRepos, repos, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+		t.Errorf(`List("netflix", 3, "score") got diff (-want +got):\n%s`, diff)
+	}
+}
+
+func TestListFilter(t *testing.T) {
+	serv := fakegithub.NewRESTServer(t, fakegithub.Netflix())
+	defer serv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL = fakegithub.BaseURL(t, serv)
+
+	names, err := topn.CompileNames([]string{"*"}, []string{"*monkey", "boq*"})
+	if err != nil {
+		t.Fatalf("CompileNames() failed: %v", err)
+	}
+
+	tests := []struct {
+		desc      string
+		filter    topn.Filter
+		wantRepos []*topn.Repo
+	}{
+		{
+			desc:   "names",
+			filter: topn.Filter{Names: names},
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963},
+				{Name: "Hystrix", Stars: 10248, Forks: 728},
+				{Name: "SimianArmy", Stars: 0, Forks: 4253},
+				{Name: "zuul", Stars: 0, Forks: 0},
+			},
+		},
+		{
+			desc:   "not archived",
+			filter: topn.Filter{Archived: github.Bool(false)},
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963},
+				{Name: "Hystrix", Stars: 10248, Forks: 728},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017},
+				{Name: "zuul", Stars: 0, Forks: 0},
+			},
+		},
+		{
+			desc:   "language",
+			filter: topn.Filter{Language: "java"},
+			wantRepos: []*topn.Repo{
+				{Name: "Hystrix", Stars: 10248, Forks: 728},
+				{Name: "SimianArmy", Stars: 0, Forks: 4253},
+				{Name: "zuul", Stars: 0, Forks: 0},
+			},
+		},
+		{
+			desc:   "topic",
+			filter: topn.Filter{Topic: "chaos-engineering"},
+			wantRepos: []*topn.Repo{
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017},
+				{Name: "SimianArmy", Stars: 0, Forks: 4253},
+			},
+		},
+		{
+			desc:   "forks only",
+			filter: topn.Filter{Fork: github.Bool(true)},
+			wantRepos: []*topn.Repo{
+				{Name: "boqboqboq", Stars: 64, Forks: 9},
+			},
+		},
+		{
+			desc:   "private forks",
+			filter: topn.Filter{Visibility: "private", Fork: github.Bool(true)},
+			wantRepos: []*topn.Repo{
+				{Name: "boqboqboq", Stars: 64, Forks: 9},
+			},
+		},
+		{
+			desc:   "min stars and pushed after",
+			filter: topn.Filter{MinStars: 10, PushedAfter: fakegithub.Q4.Since},
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			backend := repo.TopN{Client: client, FillPRsConcurrency: 1, Filter: tt.filter}
+			repos, err := backend.List(context.Background(), "netflix", 10, "stars")
+			if err != nil {
+				t.Fatalf(`List("netflix", 10, "stars") failed: %v`, err)
+			}
+
+			if diff := cmp.Diff(tt.wantRepos, repos); diff != "" {
+				t.Errorf(`List("netflix", 10, "stars") got diff (-want +got):\n%s`, diff)
+			}
+		})
+	}
+}
+
+func TestListOrder(t *testing.T) {
+	serv := fakegithub.NewRESTServer(t, fakegithub.Netflix())
+	defer serv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL = fakegithub.BaseURL(t, serv)
+
+	tests := []struct {
+		metric    string
+		order     topn.Order
+		wantRepos []*topn.Repo
+	}{
+		{
+			// Search sorts stars in ascending order for us.
+			metric: "stars",
+			order:  topn.Ascending,
+			wantRepos: []*topn.Repo{
+				{Name: "SimianArmy", Stars: 0, Forks: 4253},
+				{Name: "zuul", Stars: 0, Forks: 0},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017},
+			},
+		},
+		{
+			metric: "prs",
+			order:  topn.Ascending,
+			wantRepos: []*topn.Repo{
+				{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, PRs: 1},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, PRs: 55},
+			},
+		},
+		{
+			metric: "stars",
+			order:  topn.Descending,
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963},
+				{Name: "Hystrix", Stars: 10248, Forks: 728},
+				{Name: "security_monkey", Stars: 10047, Forks: 792},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric+" "+string(tt.order), func(t *testing.T) {
+			backend := repo.TopN{Client: client, FillPRsConcurrency: 1, Order: tt.order}
+			repos, err := backend.List(context.Background(), "netflix", 3, tt.metric)
+			if err != nil {
+				t.Fatalf(`List("netflix", 3, %q) failed: %v`, tt.metric, err)
+			}
+
+			if diff := cmp.Diff(tt.wantRepos, repos); diff != "" {
+				t.Errorf("List(\"netflix\", 3, %q) got diff (-want +got):\n%s", tt.metric, diff)
+			}
+		})
+	}
+}
+
+func TestListUser(t *testing.T) {
+	userRepos := []fakegithub.Repo{
+		{Name: "dotfiles", Stars: 3, Forks: 1, PRs: 2, HasIssues: true},
+		{Name: "blog", Stars: 10, Forks: 0, PRs: 4, HasIssues: true},
+	}
+	serv := fakegithub.NewRESTServer(t, fakegithub.Netflix(), fakegithub.WithUser("alice", userRepos))
+	defer serv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL = fakegithub.BaseURL(t, serv)
+	backend := repo.TopN{Client: client, User: true, FillPRsConcurrency: 1}
+
+	repos, err := backend.List(context.Background(), "alice", 3, "stars")
+	if err != nil {
+		t.Fatalf(`List("alice", 3, "stars") failed: %v`, err)
+	}
+
+	wantRepos := []*topn.Repo{
+		{Name: "blog", Stars: 10, Forks: 0},
+		{Name: "dotfiles", Stars: 3, Forks: 1},
+	}
+	if diff := cmp.Diff(wantRepos, repos); diff != "" {
+		t.Errorf(`List("alice", 3, "stars") got diff (-want +got):\n%s`, diff)
+	}
+}
+
+func TestListLargeOrg(t *testing.T) {
+	ctx := context.Background()
+
+	// More repos than GitHub's Search API will return for a single query.
+	const numRepos = 1050
+	serv := fakegithub.NewRESTServer(t, fakegithub.Generate(numRepos))
+	defer serv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL = fakegithub.BaseURL(t, serv)
+
+	tests := []struct {
+		desc      string
+		n         int
+		metric    string
+		wantRepos []*topn.Repo
+	}{
+		{
+			desc:   "top-3 repos by stars",
+			n:      3,
+			metric: "stars",
+			wantRepos: []*topn.Repo{
+				{Name: "repo-1049", Stars: 1049, Forks: 1},
+				{Name: "repo-1048", Stars: 1048, Forks: 2},
+				{Name: "repo-1047", Stars: 1047, Forks: 3},
+			},
+		},
+		{
+			desc:   "top-3 repos by forks",
+			n:      3,
+			metric: "forks",
+			wantRepos: []*topn.Repo{
+				{Name: "repo-0000", Stars: 0, Forks: 1050},
+				{Name: "repo-0001", Stars: 1, Forks: 1049},
+				{Name: "repo-0002", Stars: 2, Forks: 1048},
+			},
+		},
+		{
+			desc:   "top-3 repos by prs",
+			n:      3,
+			metric: "prs",
+			wantRepos: []*topn.Repo{
+				{Name: "repo-1049", Stars: 1049, Forks: 1, PRs: 2098},
+				{Name: "repo-1048", Stars: 1048, Forks: 2, PRs: 2096},
+				{Name: "repo-1047", Stars: 1047, Forks: 3, PRs: 2094},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			backend := repo.TopN{Client: client, FillPRsConcurrency: 10}
+			repos, err := backend.List(ctx, "netflix", tt.n, tt.metric)
+			if err != nil {
+				t.Fatalf(`List("netflix", %d, %q) failed: %v`, tt.n, tt.metric, err)
+			}
+
+			if diff := cmp.Diff(tt.wantRepos, repos); diff != "" {
+				t.Errorf("List(\"netflix\", %d, %q) got diff (-want +got):\n%s", tt.n, tt.metric, diff)
+			}
+		})
+	}
+
+	t.Run("all repos", func(t *testing.T) {
+		backend := repo.TopN{Client: client, FillPRsConcurrency: 10}
+		repos, err := backend.List(ctx, "netflix", 9999, "stars")
+		if err != nil {
+			t.Fatalf(`List("netflix", 9999, "stars") failed: %v`, err)
+		}
+		if got := len(repos); got != numRepos {
+			t.Errorf(`List("netflix", 9999, "stars") returned %d repos, want %d`, got, numRepos)
+		}
+	})
+
+	// Listing every repo doesn't filter them like Search does, so they're
+	// filtered after.
+	t.Run("filtered repos", func(t *testing.T) {
+		backend := repo.TopN{Client: client, FillPRsConcurrency: 10, Filter: topn.Filter{MinStars: 10}}
+		repos, err := backend.List(ctx, "netflix", 3, "forks")
+		if err != nil {
+			t.Fatalf(`List("netflix", 3, "forks") failed: %v`, err)
+		}
+
+		wantRepos := []*topn.Repo{
+			{Name: "repo-0010", Stars: 10, Forks: 1040},
+			{Name: "repo-0011", Stars: 11, Forks: 1039},
+			{Name: "repo-0012", Stars: 12, Forks: 1038},
+		}
+		if diff := cmp.Diff(wantRepos, repos); diff != "" {
+			t.Errorf(`List("netflix", 3, "forks") got diff (-want +got):\n%s`, diff)
+		}
+	})
+
+	t.Run("bottom repos", func(t *testing.T) {
+		backend := repo.TopN{Client: client, FillPRsConcurrency: 10, Order: topn.Ascending}
+		repos, err := backend.List(ctx, "netflix", 3, "stars")
+		if err != nil {
+			t.Fatalf(`List("netflix", 3, "stars") failed: %v`, err)
+		}
+
+		wantRepos := []*topn.Repo{
+			{Name: "repo-0000", Stars: 0, Forks: 1050},
+			{Name: "repo-0001", Stars: 1, Forks: 1049},
+			{Name: "repo-0002", Stars: 2, Forks: 1048},
+		}
+		if diff := cmp.Diff(wantRepos, repos); diff != "" {
+			t.Errorf(`List("netflix", 3, "stars") got diff (-want +got):\n%s`, diff)
+		}
+	})
+}
+
+func TestListRateLimited(t *testing.T) {
+	ctx := context.Background()
+
+	serv := fakegithub.NewRESTServer(t, fakegithub.Netflix(), fakegithub.WithRateLimit(4))
+	defer serv.Close()
+	client := github.NewClient(&http.Client{Transport: &retry.Transport{
+		MaxRetries: 5,
+		BaseDelay:  time.Millisecond,
+	}})
+	client.BaseURL = fakegithub.BaseURL(t, serv)
+
+	backend := repo.TopN{Client: client, FillPRsConcurrency: 1}
+	repos, err := backend.List(ctx, "netflix", 3, "prs")
+	if err != nil {
+		t.Fatalf(`List("netflix", 3, "prs") failed: %v`, err)
+	}
+
+	wantRepos := []*topn.Repo{
+		{Name: "SimianArmy", Stars: 0, Forks: 4253, PRs: 39811},
+		{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555},
+		{Name: "zuul", Stars: 0, Forks: 0, PRs: 2305},
+	}
+	if diff := cmp.Diff(wantRepos, repos); diff != "" {
+		t.Errorf(`List("netflix", 3, "prs") got diff (-want +got):\n%s`, diff)
+	}
+}
+
+func TestListCanceled(t *testing.T) {
+	serv := fakegithub.NewRESTServer(t, fakegithub.Generate(200), fakegithub.WithLatency(10*time.Millisecond))
+	defer serv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL = fakegithub.BaseURL(t, serv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	backend := repo.TopN{Client: client, FillPRsConcurrency: 2}
+	if _, err := backend.List(ctx, "netflix", 3, "prs"); err == nil {
+		t.Error(`List("netflix", 3, "prs") succeeded, want error after context deadline`)
+	}
+}
+
+func BenchmarkListPRs(b *testing.B) {
+	ctx := context.Background()
+
+	serv := fakegithub.NewRESTServer(b, fakegithub.Generate(100), fakegithub.WithLatency(5*time.Millisecond))
+	defer serv.Close()
+	client := github.NewClient(nil)
+	client.BaseURL = fakegithub.BaseURL(b, serv)
+
+	for _, concurrency := range []int{1, 10, 50} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			backend := repo.TopN{Client: client, FillPRsConcurrency: concurrency}
+			for i := 0; i < b.N; i++ {
+				if _, err := backend.List(ctx, "netflix", 3, "prs"); err != nil {
+					b.Fatalf(`List("netflix", 3, "prs") failed: %v`, err)
+				}
+			}
+		})
+	}
+}
+
+func TestMeasured(t *testing.T) {
+	backend := repo.TopN{}
+	// PRs are only counted when ranking by them.
+	for metric, want := range map[string][]string{
+		"stars":    {"stars", "forks"},
+		"prs":      {"stars", "forks", "prs"},
+		"contribs": {"stars", "forks", "contribs"},
+	} {
+		if diff := cmp.Diff(want, backend.Measured(metric)); diff != "" {
+			t.Errorf("Measured(%q) got diff (-want +got):\n%s", metric, diff)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package repoql
+
+import (
+	"context"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+)
+
+// rateLimit is the GraphQL API rate limit, as of after a query.
+type rateLimit struct {
+	// Cost is the points the query cost.
+	Cost      int
+	Remaining int
+	ResetAt   githubv4.DateTime
+}
+
+// Stats are the GraphQL API rate limit points spent by queries. See
+// https://docs.github.com/en/graphql/overview/resource-limitations for how
+// queries are scored.
+type Stats struct {
+	// Queries is the number of queries made.
+	Queries int
+	// Cost is the total points the queries cost.
+	Cost int
+	// Remaining is the points left after the queries, until ResetAt.
+	Remaining int
+	ResetAt   time.Time
+}
+
+// record adds a query that cost rl.
+func (s *Stats) record(rl rateLimit) {
+	s.Add(Stats{Queries: 1, Cost: rl.Cost, Remaining: rl.Remaining, ResetAt: rl.ResetAt.Time})
+}
+
+// Add adds the queries of other to s, such as those of another List call. The
+// points remaining are the least of the two, unless other's are from a later
+// rate limit window.
+func (s *Stats) Add(other Stats) {
+	if other.Queries == 0 {
+		return
+	}
+	if s.Queries == 0 || other.ResetAt.After(s.ResetAt) ||
+		(other.ResetAt.Equal(s.ResetAt) && other.Remaining < s.Remaining) {
+		s.Remaining, s.ResetAt = other.Remaining, other.ResetAt
+	}
+	s.Queries += other.Queries
+	s.Cost += other.Cost
+}
+
+// countQuery counts the owner's repos, the same ones query pages through.
+type countQuery struct {
+	RepositoryOwner struct {
+		Repositories totalCount `graphql:"repositories(ownerAffiliations: OWNER, isFork: $isFork)"`
+	} `graphql:"repositoryOwner(login: $login)"`
+	RateLimit rateLimit
+}
+
+// Estimate is the estimated cost of listing an owner's repos.
+type Estimate struct {
+	// Repos is the number of repos the owner has, before filtering by anything
+	// but forks.
+	Repos int
+	// Pages is the number of queries needed to page through the repos.
+	Pages int
+	// PageCost is the points each page costs.
+	PageCost int
+	// Cost is the total points the pages cost. Windowed metrics need more
+	// queries for repos with more than 100 items in their connections, which
+	// aren't included since they can't be known in advance.
+	Cost int
+	// Remaining is the points left, until ResetAt.
+	Remaining int
+	ResetAt   time.Time
+}
+
+// Estimate estimates the cost of listing the org's repos by metric, without
+// listing them. It counts the org's repos, which costs a point, and has GitHub
+// calculate the cost of a page of repos without querying for it.
+func (t *TopN) Estimate(ctx context.Context, org string, metric string) (*Estimate, error) {
+	components, err := t.components(metric)
+	if err != nil {
+		return nil, err
+	}
+
+	var cq countQuery
+	vars := t.vars(org, components)
+	countVars := map[string]interface{}{"login": vars["login"], "isFork": vars["isFork"]}
+	if err := t.Client.Query(ctx, &cq, countVars); err != nil {
+		return nil, err
+	}
+
+	var q query
+	vars["dryRun"] = githubv4.Boolean(true)
+	if err := t.Client.Query(ctx, &q, vars); err != nil {
+		return nil, err
+	}
+
+	repos := cq.RepositoryOwner.Repositories.TotalCount
+	// Even an owner without repos takes a query.
+	pages := (repos + 99) / 100
+	if pages == 0 {
+		pages = 1
+	}
+	return &Estimate{
+		Repos:     repos,
+		Pages:     pages,
+		PageCost:  q.RateLimit.Cost,
+		Cost:      pages * q.RateLimit.Cost,
+		Remaining: q.RateLimit.Remaining,
+		ResetAt:   q.RateLimit.ResetAt.Time,
+	}, nil
+}
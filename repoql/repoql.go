@@ -5,119 +5,441 @@ package repoql
 
 import (
 	"context"
+	"fmt"
 	"math"
-	"sort"
+	"time"
 
 	"github.com/shurcooL/githubv4"
+	"github.com/vtsao/repon/topn"
 )
 
-type repos []*Repo
+var _ topn.Backend = (*TopN)(nil)
 
-func (r repos) Len() int      { return len(r) }
-func (r repos) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+type totalCount struct {
+	TotalCount int
+}
 
-// Note that all of these sort in descending order, which is why the Less() is
-// reversed.
+type pageInfo struct {
+	EndCursor   githubv4.String
+	HasNextPage bool
+}
 
-type byStars struct{ repos }
+// qlRepo is the shape of the GraphQL Repository object we query for.
+//
+// Fields only needed for some metrics are conditionally included with
+// @include directives. These fields are aliased to their own name, so the
+// GraphQL client still matches them to the response.
+type qlRepo struct {
+	Name             string
+	StargazerCount   int
+	ForkCount        int
+	PullRequests     totalCount
+	Issues           totalCount `graphql:"issues: issues(states: OPEN) @include(if: $withIssues)"`
+	Watchers         totalCount `graphql:"watchers: watchers @include(if: $withWatchers)"`
+	Releases         totalCount `graphql:"releases: releases @include(if: $withReleases)"`
+	DefaultBranchRef struct {
+		Target struct {
+			Commit struct {
+				History totalCount
+			} `graphql:"... on Commit"`
+		}
+	} `graphql:"defaultBranchRef: defaultBranchRef @include(if: $withCommits)"`
+	DiskUsage int `graphql:"diskUsage: diskUsage @include(if: $withSize)"`
 
-func (r byStars) Less(i, j int) bool {
-	return r.repos[i].StargazerCount > r.repos[j].StargazerCount
+	// Fields repos are filtered on. Topics are only included when filtering by
+	// topic, since they're a connection of their own.
+	PrimaryLanguage struct {
+		Name string
+	}
+	RepositoryTopics struct {
+		Nodes []struct {
+			Topic struct {
+				Name string
+			}
+		}
+	} `graphql:"repositoryTopics: repositoryTopics(first: 100) @include(if: $withTopics)"`
+	IsArchived bool
+	IsFork     bool
+	IsMirror   bool
+	Visibility string
+	PushedAt   githubv4.DateTime
+
+	// Windowed metrics are counted from connections ordered newest first, which
+	// are paged through until reaching items from before the window.
+	PRsOpened struct {
+		Nodes    []struct{ CreatedAt githubv4.DateTime }
+		PageInfo pageInfo
+	} `graphql:"prsOpened: pullRequests(first: 100, after: $after, orderBy: {field: CREATED_AT, direction: DESC}) @include(if: $withPRsOpened)"`
+	// PRs are merged after they're last updated, so ordering by when they were
+	// updated lets us stop at merged PRs from before the window.
+	PRsMerged struct {
+		Nodes []struct {
+			MergedAt  githubv4.DateTime
+			UpdatedAt githubv4.DateTime
+		}
+		PageInfo pageInfo
+	} `graphql:"prsMerged: pullRequests(first: 100, after: $after, states: MERGED, orderBy: {field: UPDATED_AT, direction: DESC}) @include(if: $withPRsMerged)"`
+	IssuesOpened struct {
+		Nodes    []struct{ CreatedAt githubv4.DateTime }
+		PageInfo pageInfo
+	} `graphql:"issuesOpened: issues(first: 100, after: $after, orderBy: {field: CREATED_AT, direction: DESC}) @include(if: $withIssuesOpened)"`
+	StarsGained struct {
+		Edges    []struct{ StarredAt githubv4.DateTime }
+		PageInfo pageInfo
+	} `graphql:"starsGained: stargazers(first: 100, after: $after, orderBy: {field: STARRED_AT, direction: DESC}) @include(if: $withStarsGained)"`
+	ForksGained struct {
+		Nodes    []struct{ CreatedAt githubv4.DateTime }
+		PageInfo pageInfo
+	} `graphql:"forksGained: forks(first: 100, after: $after, orderBy: {field: CREATED_AT, direction: DESC}) @include(if: $withForksGained)"`
 }
 
-type byForks struct{ repos }
+// optionalMetric is an additional metric whose fields are only queried when
+// ranking by it.
+type optionalMetric struct {
+	// include is the query variable that includes the metric's fields.
+	include string
+	value   func(r *qlRepo) float64
+}
 
-func (r byForks) Less(i, j int) bool {
-	return r.repos[i].ForkCount > r.repos[j].ForkCount
+var optionalMetrics = map[string]optionalMetric{
+	"issues": {
+		include: "withIssues",
+		value:   func(r *qlRepo) float64 { return float64(r.Issues.TotalCount) },
+	},
+	"watchers": {
+		include: "withWatchers",
+		value:   func(r *qlRepo) float64 { return float64(r.Watchers.TotalCount) },
+	},
+	"releases": {
+		include: "withReleases",
+		value:   func(r *qlRepo) float64 { return float64(r.Releases.TotalCount) },
+	},
+	"commits": {
+		include: "withCommits",
+		value: func(r *qlRepo) float64 {
+			return float64(r.DefaultBranchRef.Target.Commit.History.TotalCount)
+		},
+	},
+	"size": {
+		include: "withSize",
+		value:   func(r *qlRepo) float64 { return float64(r.DiskUsage) },
+	},
 }
 
-type byPRs struct{ repos }
+// windowItem is an item in a windowed connection.
+type windowItem struct {
+	// at is when the item happened, e.g. when a PR was merged.
+	at time.Time
+	// order is what the connection is ordered by, newest first.
+	order time.Time
+}
 
-func (r byPRs) Less(i, j int) bool {
-	return r.repos[i].PullRequests.TotalCount > r.repos[j].PullRequests.TotalCount
+// windowedMetric is a metric that counts items in a connection that happened
+// within a window. Its connection is only queried when ranking by it.
+type windowedMetric struct {
+	// include is the query variable that includes the metric's connection.
+	include string
+	// page returns a page of the metric's connection.
+	page func(r *qlRepo) ([]windowItem, pageInfo)
 }
 
-type byContribs struct{ repos }
+var windowedMetrics = map[string]windowedMetric{
+	"prs_opened": {
+		include: "withPRsOpened",
+		page: func(r *qlRepo) ([]windowItem, pageInfo) {
+			var items []windowItem
+			for _, n := range r.PRsOpened.Nodes {
+				items = append(items, windowItem{at: n.CreatedAt.Time, order: n.CreatedAt.Time})
+			}
+			return items, r.PRsOpened.PageInfo
+		},
+	},
+	"prs_merged": {
+		include: "withPRsMerged",
+		page: func(r *qlRepo) ([]windowItem, pageInfo) {
+			var items []windowItem
+			for _, n := range r.PRsMerged.Nodes {
+				items = append(items, windowItem{at: n.MergedAt.Time, order: n.UpdatedAt.Time})
+			}
+			return items, r.PRsMerged.PageInfo
+		},
+	},
+	"issues_opened": {
+		include: "withIssuesOpened",
+		page: func(r *qlRepo) ([]windowItem, pageInfo) {
+			var items []windowItem
+			for _, n := range r.IssuesOpened.Nodes {
+				items = append(items, windowItem{at: n.CreatedAt.Time, order: n.CreatedAt.Time})
+			}
+			return items, r.IssuesOpened.PageInfo
+		},
+	},
+	"stars_gained": {
+		include: "withStarsGained",
+		page: func(r *qlRepo) ([]windowItem, pageInfo) {
+			var items []windowItem
+			for _, e := range r.StarsGained.Edges {
+				items = append(items, windowItem{at: e.StarredAt.Time, order: e.StarredAt.Time})
+			}
+			return items, r.StarsGained.PageInfo
+		},
+	},
+	"forks_gained": {
+		include: "withForksGained",
+		page: func(r *qlRepo) ([]windowItem, pageInfo) {
+			var items []windowItem
+			for _, n := range r.ForksGained.Nodes {
+				items = append(items, windowItem{at: n.CreatedAt.Time, order: n.CreatedAt.Time})
+			}
+			return items, r.ForksGained.PageInfo
+		},
+	},
+}
 
-func (r byContribs) Less(i, j int) bool {
-	var contribI float64
-	if forksI := r.repos[i].ForkCount; forksI != 0 {
-		contribI = float64(r.repos[i].PullRequests.TotalCount) / float64(forksI)
+// attrs returns the attributes of r that are filtered on.
+func (r *qlRepo) attrs() topn.Attrs {
+	var topics []string
+	for _, n := range r.RepositoryTopics.Nodes {
+		topics = append(topics, n.Topic.Name)
 	}
-	var contribJ float64
-	if forksJ := r.repos[j].ForkCount; forksJ != 0 {
-		contribJ = float64(r.repos[j].PullRequests.TotalCount) / float64(forksJ)
+	return topn.Attrs{
+		Name:       r.Name,
+		Language:   r.PrimaryLanguage.Name,
+		Topics:     topics,
+		Archived:   r.IsArchived,
+		Fork:       r.IsFork,
+		Mirror:     r.IsMirror,
+		Visibility: r.Visibility,
+		Stars:      r.StargazerCount,
+		PushedAt:   r.PushedAt.Time,
 	}
-	return contribI > contribJ
 }
 
-type PullReq struct {
-	TotalCount int
-}
-
-type Repo struct {
-	Name           string
-	StargazerCount int
-	ForkCount      int
-	PullRequests   *PullReq
+// unsupportedMetrics are metrics the GraphQL API has no way to get.
+var unsupportedMetrics = map[string]bool{
+	"contributors": true,
 }
 
-var q struct {
-	Search struct {
-		Edges []struct {
-			Node struct {
-				Repository Repo `graphql:"... on Repository"`
-			}
+// toTopN converts r to the common result type shared by all backends, with the
+// metrics that were queried for.
+func (r *qlRepo) toTopN(metrics []string) *topn.Repo {
+	tr := &topn.Repo{
+		Name:  r.Name,
+		Stars: r.StargazerCount,
+		Forks: r.ForkCount,
+		PRs:   r.PullRequests.TotalCount,
+	}
+	for _, metric := range metrics {
+		if metric == "contribs" {
+			tr.SetMetric("contribs", topn.Contribs(tr.PRs, tr.Forks))
 		}
-		PageInfo struct {
-			EndCursor   githubv4.String
-			HasNextPage bool
+		if om, ok := optionalMetrics[metric]; ok {
+			tr.SetMetric(metric, om.value(r))
 		}
-	} `graphql:"search(query: $query, type: REPOSITORY, first: 100, after: $cursor)"`
+	}
+	return tr
+}
+
+// query pages through the owner's repositories connection rather than using
+// Search, since Search only ever returns the first 1,000 results. Owners are
+// either organizations or users, and only repos they own are included. Forks
+// are filtered by the connection, and the rest of Filter once repos are
+// returned.
+type query struct {
+	RepositoryOwner struct {
+		Repositories struct {
+			Nodes    []qlRepo
+			PageInfo pageInfo
+		} `graphql:"repositories(first: 100, after: $cursor, ownerAffiliations: OWNER, isFork: $isFork)"`
+	} `graphql:"repositoryOwner(login: $login)"`
+	// RateLimit is what the query cost, or would cost if it's a dry run.
+	RateLimit rateLimit `graphql:"rateLimit(dryRun: $dryRun)"`
+}
+
+// repoQuery queries a single repo, to page through a windowed metric's
+// connection past the first page.
+type repoQuery struct {
+	Repository qlRepo `graphql:"repository(owner: $login, name: $name)"`
+	RateLimit  rateLimit
 }
 
 // TopN interfaces with the GitHub GraphQL API to find the top-n GitHub repos in
 // an org based on a metric.
 type TopN struct {
 	Client *githubv4.Client
+	// Window is the time window windowed metrics, such as prs_opened, count
+	// activity in.
+	Window topn.Window
+	// Score is the composite score repos are ranked by for the "score" metric.
+	Score *topn.Score
+	// Filter restricts which repos are ranked.
+	Filter topn.Filter
+	// Order is the order repos are ranked in, descending if empty.
+	Order topn.Order
 }
 
-// List returns the top-n GitHub repos for the org by metric.
-func (t *TopN) List(ctx context.Context, org string, n int, metric string) ([]*Repo, error) {
-	vars := map[string]interface{}{
-		"query":  githubv4.String("org:" + org),
-		"cursor": (*githubv4.String)(nil),
+// List returns the top-n GitHub repos for the org by metric. The org may also be
+// a user account. It is safe for concurrent use.
+func (t *TopN) List(ctx context.Context, org string, n int, metric string) ([]*topn.Repo, error) {
+	repos, _, err := t.ListWithStats(ctx, org, n, metric)
+	return repos, err
+}
+
+// Measured implements topn.Backend. Stars, forks and PRs are queried for every
+// repo, and other metrics only when needed to rank repos by metric.
+func (t *TopN) Measured(metric string) []string {
+	return topn.Measured([]string{"stars", "forks", "prs"}, metric, t.Score)
+}
+
+// ListWithStats is like List, but also returns the rate limit points its
+// queries cost.
+func (t *TopN) ListWithStats(ctx context.Context, org string, n int, metric string) ([]*topn.Repo, Stats, error) {
+	var stats Stats
+	m, ok := topn.LookupMetric(metric)
+	if !ok {
+		return nil, stats, fmt.Errorf("unknown metric %q", metric)
 	}
+	components, err := t.components(metric)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	var q query
+	vars := t.vars(org, components)
 
-	var repos []*Repo
+	var repos []*topn.Repo
 	for {
 		err := t.Client.Query(ctx, &q, vars)
 		if err != nil {
-			return nil, err
+			return nil, stats, err
 		}
-		for _, e := range q.Search.Edges {
-			r := e.Node.Repository
-			repos = append(repos, &r)
+		stats.record(q.RateLimit)
+		conn := q.RepositoryOwner.Repositories
+		for i := range conn.Nodes {
+			r := &conn.Nodes[i]
+			// Filtered repos are skipped before paging through their windowed
+			// metrics.
+			if !t.Filter.Match(r.attrs()) {
+				continue
+			}
+			tr := r.toTopN(components)
+			for _, component := range components {
+				if _, ok := windowedMetrics[component]; !ok {
+					continue
+				}
+				count, err := t.countWindow(ctx, org, r, component, &stats)
+				if err != nil {
+					return nil, stats, err
+				}
+				tr.SetMetric(component, float64(count))
+			}
+			repos = append(repos, tr)
 		}
-		if !q.Search.PageInfo.HasNextPage {
+		if !conn.PageInfo.HasNextPage {
 			break
 		}
-		vars["cursor"] = githubv4.NewString(q.Search.PageInfo.EndCursor)
+		vars["cursor"] = githubv4.NewString(conn.PageInfo.EndCursor)
 	}
 
-	// Note that all of these sort in descending order, which is why the less func
-	// is reversed.
-	switch metric {
-	case "stars":
-		sort.Sort(byStars{repos})
-	case "forks":
-		sort.Sort(byForks{repos})
-	case "prs":
-		sort.Sort(byPRs{repos})
-	case "contribs":
-		sort.Sort(byContribs{repos})
+	topn.SetVelocities(repos, components, t.Window)
+	if metric == "score" {
+		if err := t.Score.Set(repos); err != nil {
+			return nil, stats, err
+		}
 	}
+	topn.Sort(repos, m, t.Order)
 
 	n = int(math.Min(float64(n), float64(len(repos))))
-	return repos[:n], nil
+	return repos[:n], stats, nil
+}
+
+// CheckMetric implements topn.MetricChecker.
+func (t *TopN) CheckMetric(metric string) error {
+	_, err := t.components(metric)
+	return err
+}
+
+// components returns the metrics that make up metric, which must all be
+// supported by the GraphQL API.
+func (t *TopN) components(metric string) ([]string, error) {
+	components, err := topn.Components(metric, t.Score)
+	if err != nil {
+		return nil, err
+	}
+	for _, component := range components {
+		if unsupportedMetrics[component] {
+			return nil, fmt.Errorf("metric %q isn't supported by the GitHub GraphQL API", component)
+		}
+	}
+	return components, nil
+}
+
+// vars returns the variables for the first page of a query for the org's repos,
+// including the fields for the metrics.
+func (t *TopN) vars(org string, metrics []string) map[string]interface{} {
+	vars := map[string]interface{}{
+		"login":  githubv4.String(org),
+		"cursor": (*githubv4.String)(nil),
+		"after":  (*githubv4.String)(nil),
+		// Forks are left out unless they're the only repos ranked.
+		"isFork": githubv4.NewBoolean(githubv4.Boolean(t.Filter.Forks())),
+		// Topics are only needed to filter by them.
+		"withTopics": githubv4.Boolean(t.Filter.Topic != ""),
+		"dryRun":     githubv4.Boolean(false),
+	}
+	setIncludes(vars, metrics)
+	return vars
+}
+
+// setIncludes sets the query variables that include the fields only needed for
+// some metrics, so only the metrics' fields are included.
+func setIncludes(vars map[string]interface{}, metrics []string) {
+	included := make(map[string]bool)
+	for _, metric := range metrics {
+		included[metric] = true
+	}
+	for name, om := range optionalMetrics {
+		vars[om.include] = githubv4.Boolean(included[name])
+	}
+	for name, wm := range windowedMetrics {
+		vars[wm.include] = githubv4.Boolean(included[name])
+	}
+}
+
+// countWindow counts the items in the windowed metric's connection for r that
+// happened within the window, querying for more pages as needed. The cost of
+// the queries is added to stats.
+func (t *TopN) countWindow(ctx context.Context, org string, r *qlRepo, metric string, stats *Stats) (int, error) {
+	wm := windowedMetrics[metric]
+	var vars map[string]interface{}
+	count := 0
+	for {
+		items, info := wm.page(r)
+		for _, item := range items {
+			if t.Window.Contains(item.at) {
+				count++
+			}
+		}
+		// Items are ordered newest first, so once the oldest item on the page is
+		// from before the window there's no need to look further.
+		if !info.HasNextPage || len(items) == 0 || t.Window.Before(items[len(items)-1].order) {
+			return count, nil
+		}
+
+		if vars == nil {
+			vars = map[string]interface{}{
+				"login":      githubv4.String(org),
+				"name":       githubv4.String(r.Name),
+				"withTopics": githubv4.Boolean(false),
+			}
+			setIncludes(vars, []string{metric})
+		}
+		vars["after"] = githubv4.NewString(info.EndCursor)
+		var q repoQuery
+		if err := t.Client.Query(ctx, &q, vars); err != nil {
+			return 0, err
+		}
+		stats.record(q.RateLimit)
+		r = &q.Repository
+	}
 }
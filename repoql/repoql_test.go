@@ -2,152 +2,58 @@ package repoql_test
 
 import (
 	"context"
-	"io"
+	"fmt"
 	"net/http"
-	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
-	"github.com/gorilla/mux"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/shurcooL/githubv4"
+	"github.com/vtsao/repon/internal/fakegithub"
 	"github.com/vtsao/repon/repoql"
+	"github.com/vtsao/repon/retry"
+	"github.com/vtsao/repon/topn"
 )
 
-// fakeGitHubAPIServ creates a fake GitHub GraphQL API server that returns
-// results from a hardcoded set of repositories.
-func fakeGitHubAPIServ(t *testing.T) *httptest.Server {
-	t.Helper()
-
-	router := mux.NewRouter()
-	router.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
-		result := `{
-  "data": {
-    "search": {
-      "edges": [
-        {
-          "node": {
-            "name": "security_monkey",
-            "stargazerCount": 10047,
-            "forkCount": 792,
-            "pullRequests": {
-              "totalCount": 55
-            }
-          }
-        },
-        {
-          "node": {
-            "name": "metaflow",
-            "stargazerCount": 20787,
-            "forkCount": 2963,
-            "pullRequests": {
-              "totalCount": 34555
-            }
-          }
-        },
-        {
-          "node": {
-            "name": "SimianArmy",
-            "stargazerCount": 0,
-            "forkCount": 4253,
-            "pullRequests": {
-              "totalCount": 39811
-            }
-          }
-        },
-        {
-          "node": {
-            "name": "chaosmonkey",
-            "stargazerCount": 1,
-            "forkCount": 1017,
-            "pullRequests": {
-              "totalCount": 1
-            }
-          }
-        },
-        {
-          "node": {
-            "name": "zuul",
-            "stargazerCount": 0,
-            "forkCount": 0,
-            "pullRequests": {
-              "totalCount": 2305
-            }
-          }
-        },
-        {
-          "node": {
-            "name": "Hystrix",
-            "stargazerCount": 10248,
-            "forkCount": 728,
-            "pullRequests": {
-              "totalCount": 0
-            }
-          }
-        },
-        {
-          "node": {
-            "name": "boqboqboq",
-            "stargazerCount": 64,
-            "forkCount": 9,
-            "pullRequests": {
-              "totalCount": 1
-            }
-          }
-        }
-      ]
-    }
-  }
-}`
-
-		// We don't deal with pagination here b/c the TopN tool pages by 100 and we
-		// have < 100 fake repos. But ideally a fake should deal with pagination.
-
-		if _, err := io.WriteString(w, result); err != nil {
-			t.Fatalf("WriteString(%s) failed: %v", result, err)
-		}
-	})
-
-	apiHandler := http.NewServeMux()
-	apiHandler.Handle("/", router)
-
-	return httptest.NewServer(apiHandler)
-}
-
 func TestList(t *testing.T) {
 	ctx := context.Background()
 
-	serv := fakeGitHubAPIServ(t)
+	serv := fakegithub.NewGraphQLServer(t, fakegithub.Netflix())
+	defer serv.Close()
 	client := githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil)
-	topn := repoql.TopN{Client: client}
+	backend := repoql.TopN{Client: client}
 
 	tests := []struct {
 		desc      string
 		n         int
 		metric    string
-		wantRepos []*repoql.Repo
+		wantRepos []*topn.Repo
 	}{
 		{
 			desc:   "top-3 repos by stars",
 			n:      3,
 			metric: "stars",
-			wantRepos: []*repoql.Repo{
+			wantRepos: []*topn.Repo{
 				{
-					Name:           "metaflow",
-					StargazerCount: 20787,
-					ForkCount:      2963,
-					PullRequests:   &repoql.PullReq{TotalCount: 34555},
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
+					PRs:   34555,
 				},
 				{
-					Name:           "Hystrix",
-					StargazerCount: 10248,
-					ForkCount:      728,
-					PullRequests:   &repoql.PullReq{TotalCount: 0},
+					Name:  "Hystrix",
+					Stars: 10248,
+					Forks: 728,
+					PRs:   0,
 				},
 				{
-					Name:           "security_monkey",
-					StargazerCount: 10047,
-					ForkCount:      792,
-					PullRequests:   &repoql.PullReq{TotalCount: 55},
+					Name:  "security_monkey",
+					Stars: 10047,
+					Forks: 792,
+					PRs:   55,
 				},
 			},
 		},
@@ -155,24 +61,24 @@ func TestList(t *testing.T) {
 			desc:   "top-3 repos by forks",
 			n:      3,
 			metric: "forks",
-			wantRepos: []*repoql.Repo{
+			wantRepos: []*topn.Repo{
 				{
-					Name:           "SimianArmy",
-					StargazerCount: 0,
-					ForkCount:      4253,
-					PullRequests:   &repoql.PullReq{TotalCount: 39811},
+					Name:  "SimianArmy",
+					Stars: 0,
+					Forks: 4253,
+					PRs:   39811,
 				},
 				{
-					Name:           "metaflow",
-					StargazerCount: 20787,
-					ForkCount:      2963,
-					PullRequests:   &repoql.PullReq{TotalCount: 34555},
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
+					PRs:   34555,
 				},
 				{
-					Name:           "chaosmonkey",
-					StargazerCount: 1,
-					ForkCount:      1017,
-					PullRequests:   &repoql.PullReq{TotalCount: 1},
+					Name:  "chaosmonkey",
+					Stars: 1,
+					Forks: 1017,
+					PRs:   1,
 				},
 			},
 		},
@@ -180,24 +86,24 @@ func TestList(t *testing.T) {
 			desc:   "top-3 repos by prs",
 			n:      3,
 			metric: "prs",
-			wantRepos: []*repoql.Repo{
+			wantRepos: []*topn.Repo{
 				{
-					Name:           "SimianArmy",
-					StargazerCount: 0,
-					ForkCount:      4253,
-					PullRequests:   &repoql.PullReq{TotalCount: 39811},
+					Name:  "SimianArmy",
+					Stars: 0,
+					Forks: 4253,
+					PRs:   39811,
 				},
 				{
-					Name:           "metaflow",
-					StargazerCount: 20787,
-					ForkCount:      2963,
-					PullRequests:   &repoql.PullReq{TotalCount: 34555},
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
+					PRs:   34555,
 				},
 				{
-					Name:           "zuul",
-					StargazerCount: 0,
-					ForkCount:      0,
-					PullRequests:   &repoql.PullReq{TotalCount: 2305},
+					Name:  "zuul",
+					Stars: 0,
+					Forks: 0,
+					PRs:   2305,
 				},
 			},
 		},
@@ -205,24 +111,167 @@ func TestList(t *testing.T) {
 			desc:   "top-3 repos by contribs",
 			n:      3,
 			metric: "contribs",
-			wantRepos: []*repoql.Repo{
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "metaflow",
+					Stars:   20787,
+					Forks:   2963,
+					PRs:     34555,
+					Metrics: map[string]float64{"contribs": 34555.0 / 2963},
+				},
+				{
+					Name:    "SimianArmy",
+					Stars:   0,
+					Forks:   4253,
+					PRs:     39811,
+					Metrics: map[string]float64{"contribs": 39811.0 / 4253},
+				},
+				{
+					Name:    "security_monkey",
+					Stars:   10047,
+					Forks:   792,
+					PRs:     55,
+					Metrics: map[string]float64{"contribs": 55.0 / 792},
+				},
+			},
+		},
+		{
+			desc:   "top-3 repos by issues",
+			n:      3,
+			metric: "issues",
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "Hystrix",
+					Stars:   10248,
+					Forks:   728,
+					PRs:     0,
+					Metrics: map[string]float64{"issues": 300},
+				},
+				{
+					Name:    "metaflow",
+					Stars:   20787,
+					Forks:   2963,
+					PRs:     34555,
+					Metrics: map[string]float64{"issues": 150},
+				},
+				{
+					Name:    "security_monkey",
+					Stars:   10047,
+					Forks:   792,
+					PRs:     55,
+					Metrics: map[string]float64{"issues": 20},
+				},
+			},
+		},
+		{
+			desc:   "top-3 repos by watchers",
+			n:      3,
+			metric: "watchers",
+			wantRepos: []*topn.Repo{
 				{
-					Name:           "metaflow",
-					StargazerCount: 20787,
-					ForkCount:      2963,
-					PullRequests:   &repoql.PullReq{TotalCount: 34555},
+					Name:    "zuul",
+					Stars:   0,
+					Forks:   0,
+					PRs:     2305,
+					Metrics: map[string]float64{"watchers": 1200},
 				},
 				{
-					Name:           "SimianArmy",
-					StargazerCount: 0,
-					ForkCount:      4253,
-					PullRequests:   &repoql.PullReq{TotalCount: 39811},
+					Name:    "Hystrix",
+					Stars:   10248,
+					Forks:   728,
+					PRs:     0,
+					Metrics: map[string]float64{"watchers": 1000},
 				},
 				{
-					Name:           "boqboqboq",
-					StargazerCount: 64,
-					ForkCount:      9,
-					PullRequests:   &repoql.PullReq{TotalCount: 1},
+					Name:    "SimianArmy",
+					Stars:   0,
+					Forks:   4253,
+					PRs:     39811,
+					Metrics: map[string]float64{"watchers": 700},
+				},
+			},
+		},
+		{
+			desc:   "top-3 repos by releases",
+			n:      3,
+			metric: "releases",
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "zuul",
+					Stars:   0,
+					Forks:   0,
+					PRs:     2305,
+					Metrics: map[string]float64{"releases": 90},
+				},
+				{
+					Name:    "metaflow",
+					Stars:   20787,
+					Forks:   2963,
+					PRs:     34555,
+					Metrics: map[string]float64{"releases": 60},
+				},
+				{
+					Name:    "security_monkey",
+					Stars:   10047,
+					Forks:   792,
+					PRs:     55,
+					Metrics: map[string]float64{"releases": 40},
+				},
+			},
+		},
+		{
+			desc:   "top-3 repos by commits",
+			n:      3,
+			metric: "commits",
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "zuul",
+					Stars:   0,
+					Forks:   0,
+					PRs:     2305,
+					Metrics: map[string]float64{"commits": 3000},
+				},
+				{
+					Name:    "security_monkey",
+					Stars:   10047,
+					Forks:   792,
+					PRs:     55,
+					Metrics: map[string]float64{"commits": 2400},
+				},
+				{
+					Name:    "Hystrix",
+					Stars:   10248,
+					Forks:   728,
+					PRs:     0,
+					Metrics: map[string]float64{"commits": 2100},
+				},
+			},
+		},
+		{
+			desc:   "top-3 repos by size",
+			n:      3,
+			metric: "size",
+			wantRepos: []*topn.Repo{
+				{
+					Name:    "zuul",
+					Stars:   0,
+					Forks:   0,
+					PRs:     2305,
+					Metrics: map[string]float64{"size": 30000},
+				},
+				{
+					Name:    "metaflow",
+					Stars:   20787,
+					Forks:   2963,
+					PRs:     34555,
+					Metrics: map[string]float64{"size": 25000},
+				},
+				{
+					Name:    "Hystrix",
+					Stars:   10248,
+					Forks:   728,
+					PRs:     0,
+					Metrics: map[string]float64{"size": 12000},
 				},
 			},
 		},
@@ -230,12 +279,12 @@ func TestList(t *testing.T) {
 			desc:   "top-1 repos by stars",
 			n:      1,
 			metric: "stars",
-			wantRepos: []*repoql.Repo{
+			wantRepos: []*topn.Repo{
 				{
-					Name:           "metaflow",
-					StargazerCount: 20787,
-					ForkCount:      2963,
-					PullRequests:   &repoql.PullReq{TotalCount: 34555},
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
+					PRs:   34555,
 				},
 			},
 		},
@@ -243,48 +292,42 @@ func TestList(t *testing.T) {
 			desc:   "top-9999 repos by stars",
 			n:      9999,
 			metric: "stars",
-			wantRepos: []*repoql.Repo{
-				{
-					Name:           "metaflow",
-					StargazerCount: 20787,
-					ForkCount:      2963,
-					PullRequests:   &repoql.PullReq{TotalCount: 34555},
-				},
+			wantRepos: []*topn.Repo{
 				{
-					Name:           "Hystrix",
-					StargazerCount: 10248,
-					ForkCount:      728,
-					PullRequests:   &repoql.PullReq{TotalCount: 0},
+					Name:  "metaflow",
+					Stars: 20787,
+					Forks: 2963,
+					PRs:   34555,
 				},
 				{
-					Name:           "security_monkey",
-					StargazerCount: 10047,
-					ForkCount:      792,
-					PullRequests:   &repoql.PullReq{TotalCount: 55},
+					Name:  "Hystrix",
+					Stars: 10248,
+					Forks: 728,
+					PRs:   0,
 				},
 				{
-					Name:           "boqboqboq",
-					StargazerCount: 64,
-					ForkCount:      9,
-					PullRequests:   &repoql.PullReq{TotalCount: 1},
+					Name:  "security_monkey",
+					Stars: 10047,
+					Forks: 792,
+					PRs:   55,
 				},
 				{
-					Name:           "chaosmonkey",
-					StargazerCount: 1,
-					ForkCount:      1017,
-					PullRequests:   &repoql.PullReq{TotalCount: 1},
+					Name:  "chaosmonkey",
+					Stars: 1,
+					Forks: 1017,
+					PRs:   1,
 				},
 				{
-					Name:           "SimianArmy",
-					StargazerCount: 0,
-					ForkCount:      4253,
-					PullRequests:   &repoql.PullReq{TotalCount: 39811},
+					Name:  "SimianArmy",
+					Stars: 0,
+					Forks: 4253,
+					PRs:   39811,
 				},
 				{
-					Name:           "zuul",
-					StargazerCount: 0,
-					ForkCount:      0,
-					PullRequests:   &repoql.PullReq{TotalCount: 2305},
+					Name:  "zuul",
+					Stars: 0,
+					Forks: 0,
+					PRs:   2305,
 				},
 			},
 		},
@@ -292,7 +335,367 @@ func TestList(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.desc, func(t *testing.T) {
-			repos, err := topn.List(ctx, "netflix", tt.n, tt.metric)
+			repos, err := backend.List(ctx, "netflix", tt.n, tt.metric)
+			if err != nil {
+				t.Fatalf(`List("netflix", %d, %q) failed: %v`, tt.n, tt.metric, err)
+			}
+
+			if diff := cmp.Diff(tt.wantRepos, repos); diff != "" {
+				t.Errorf("List(\"netflix\", %d, %q) got diff (-want +got):\n%s", tt.n, tt.metric, diff)
+			}
+		})
+	}
+}
+
+func TestListUnsupportedMetric(t *testing.T) {
+	serv := fakegithub.NewGraphQLServer(t, fakegithub.Netflix())
+	defer serv.Close()
+	backend := repoql.TopN{Client: githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil)}
+
+	if _, err := backend.List(context.Background(), "netflix", 3, "contributors"); err == nil {
+		t.Error(`List("netflix", 3, "contributors") succeeded, want error`)
+	}
+	if err := backend.CheckMetric("contributors"); err == nil {
+		t.Error(`CheckMetric("contributors") succeeded, want error`)
+	}
+	if err := backend.CheckMetric("stars"); err != nil {
+		t.Errorf(`CheckMetric("stars") failed: %v`, err)
+	}
+}
+
+func TestListWindowed(t *testing.T) {
+	ctx := context.Background()
+
+	serv := fakegithub.NewGraphQLServer(t, fakegithub.Netflix())
+	defer serv.Close()
+	backend := repoql.TopN{
+		Client: githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil),
+		Window: fakegithub.Q4,
+	}
+	days := fakegithub.Q4.Days()
+
+	tests := []struct {
+		metric    string
+		wantRepos []*topn.Repo
+	}{
+		{
+			metric: "prs_opened",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555, Metrics: map[string]float64{"prs_opened": 5}},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0, Metrics: map[string]float64{"prs_opened": 4}},
+				{Name: "zuul", Stars: 0, Forks: 0, PRs: 2305, Metrics: map[string]float64{"prs_opened": 3}},
+			},
+		},
+		{
+			metric: "prs_merged",
+			wantRepos: []*topn.Repo{
+				{Name: "zuul", Stars: 0, Forks: 0, PRs: 2305, Metrics: map[string]float64{"prs_merged": 4}},
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555, Metrics: map[string]float64{"prs_merged": 3}},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, PRs: 55, Metrics: map[string]float64{"prs_merged": 2}},
+			},
+		},
+		{
+			metric: "issues_opened",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555, Metrics: map[string]float64{"issues_opened": 4}},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, PRs: 1, Metrics: map[string]float64{"issues_opened": 3}},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0, Metrics: map[string]float64{"issues_opened": 2}},
+			},
+		},
+		{
+			metric: "stars_gained",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555, Metrics: map[string]float64{"stars_gained": 120}},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0, Metrics: map[string]float64{"stars_gained": 4}},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, PRs: 55, Metrics: map[string]float64{"stars_gained": 2}},
+			},
+		},
+		{
+			metric: "forks_gained",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555, Metrics: map[string]float64{"forks_gained": 110}},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, PRs: 55, Metrics: map[string]float64{"forks_gained": 2}},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, PRs: 1, Metrics: map[string]float64{"forks_gained": 1}},
+			},
+		},
+		{
+			// Velocities come with the windowed metric they're derived from.
+			metric: "stars_velocity",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555, Metrics: map[string]float64{"stars_gained": 120, "stars_velocity": 120 / days}},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0, Metrics: map[string]float64{"stars_gained": 4, "stars_velocity": 4 / days}},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, PRs: 55, Metrics: map[string]float64{"stars_gained": 2, "stars_velocity": 2 / days}},
+			},
+		},
+		{
+			metric: "forks_velocity",
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555, Metrics: map[string]float64{"forks_gained": 110, "forks_velocity": 110 / days}},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, PRs: 55, Metrics: map[string]float64{"forks_gained": 2, "forks_velocity": 2 / days}},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, PRs: 1, Metrics: map[string]float64{"forks_gained": 1, "forks_velocity": 1 / days}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			repos, err := backend.List(ctx, "netflix", 3, tt.metric)
+			if err != nil {
+				t.Fatalf(`List("netflix", 3, %q) failed: %v`, tt.metric, err)
+			}
+
+			if diff := cmp.Diff(tt.wantRepos, repos); diff != "" {
+				t.Errorf("List(\"netflix\", 3, %q) got diff (-want +got):\n%s", tt.metric, diff)
+			}
+		})
+	}
+}
+
+func TestListScore(t *testing.T) {
+	serv := fakegithub.NewGraphQLServer(t, fakegithub.Netflix())
+	defer serv.Close()
+	backend := repoql.TopN{
+		Client: githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil),
+		Score:  &topn.Score{Weights: map[string]float64{"stars": 1, "forks": 1}, Normalize: "minmax"},
+	}
+
+	repos, err := backend.List(context.Background(), "netflix", 3, "score")
+	if err != nil {
+		t.Fatalf(`List("netflix", 3, "score") failed: %v`, err)
+	}
+
+	// Stars and forks are normalized by the most stars (metaflow) and forks
+	// (SimianArmy) in the org.
+	wantRepos := []*topn.Repo{
+		{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555, Metrics: map[string]float64{"score": 1 + 2963.0/4253}},
+		{Name: "SimianArmy", Stars: 0, Forks: 4253, PRs: 39811, Metrics: map[string]float64{"score": 1}},
+		{Name: "security_monkey", Stars: 10047, Forks: 792, PRs: 55, Metrics: map[string]float64{"score": 10047.0/20787 + 792.0/4253}},
+	}
+	if diff := cmp.Diff(wantRepos, repos, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+		t.Errorf(`List("netflix", 3, "score") got diff (-want +got):\n%s`, diff)
+	}
+}
+
+func TestListFilter(t *testing.T) {
+	serv := fakegithub.NewGraphQLServer(t, fakegithub.Netflix())
+	defer serv.Close()
+	client := githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil)
+
+	names, err := topn.CompileNames([]string{"*"}, []string{"*monkey", "boq*"})
+	if err != nil {
+		t.Fatalf("CompileNames() failed: %v", err)
+	}
+
+	tests := []struct {
+		desc      string
+		filter    topn.Filter
+		wantRepos []*topn.Repo
+	}{
+		{
+			desc:   "names",
+			filter: topn.Filter{Names: names},
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0},
+				{Name: "SimianArmy", Stars: 0, Forks: 4253, PRs: 39811},
+				{Name: "zuul", Stars: 0, Forks: 0, PRs: 2305},
+			},
+		},
+		{
+			desc:   "not archived",
+			filter: topn.Filter{Archived: boolPtr(false)},
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, PRs: 1},
+				{Name: "zuul", Stars: 0, Forks: 0, PRs: 2305},
+			},
+		},
+		{
+			desc:   "language",
+			filter: topn.Filter{Language: "java"},
+			wantRepos: []*topn.Repo{
+				{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0},
+				{Name: "SimianArmy", Stars: 0, Forks: 4253, PRs: 39811},
+				{Name: "zuul", Stars: 0, Forks: 0, PRs: 2305},
+			},
+		},
+		{
+			desc:   "topic",
+			filter: topn.Filter{Topic: "chaos-engineering"},
+			wantRepos: []*topn.Repo{
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, PRs: 1},
+				{Name: "SimianArmy", Stars: 0, Forks: 4253, PRs: 39811},
+			},
+		},
+		{
+			desc:   "forks only",
+			filter: topn.Filter{Fork: boolPtr(true)},
+			wantRepos: []*topn.Repo{
+				{Name: "boqboqboq", Stars: 64, Forks: 9, PRs: 1},
+			},
+		},
+		{
+			desc:   "private forks",
+			filter: topn.Filter{Visibility: "private", Fork: boolPtr(true)},
+			wantRepos: []*topn.Repo{
+				{Name: "boqboqboq", Stars: 64, Forks: 9, PRs: 1},
+			},
+		},
+		{
+			desc:   "min stars and pushed after",
+			filter: topn.Filter{MinStars: 10, PushedAfter: fakegithub.Q4.Since},
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			backend := repoql.TopN{Client: client, Filter: tt.filter}
+			repos, err := backend.List(context.Background(), "netflix", 10, "stars")
+			if err != nil {
+				t.Fatalf(`List("netflix", 10, "stars") failed: %v`, err)
+			}
+
+			if diff := cmp.Diff(tt.wantRepos, repos); diff != "" {
+				t.Errorf(`List("netflix", 10, "stars") got diff (-want +got):\n%s`, diff)
+			}
+		})
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestListOrder(t *testing.T) {
+	serv := fakegithub.NewGraphQLServer(t, fakegithub.Netflix())
+	defer serv.Close()
+	client := githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil)
+
+	tests := []struct {
+		metric    string
+		order     topn.Order
+		wantRepos []*topn.Repo
+	}{
+		{
+			metric: "stars",
+			order:  topn.Ascending,
+			wantRepos: []*topn.Repo{
+				{Name: "SimianArmy", Stars: 0, Forks: 4253, PRs: 39811},
+				{Name: "zuul", Stars: 0, Forks: 0, PRs: 2305},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, PRs: 1},
+			},
+		},
+		{
+			metric: "prs",
+			order:  topn.Ascending,
+			wantRepos: []*topn.Repo{
+				{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0},
+				{Name: "chaosmonkey", Stars: 1, Forks: 1017, PRs: 1},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, PRs: 55},
+			},
+		},
+		{
+			metric: "stars",
+			order:  topn.Descending,
+			wantRepos: []*topn.Repo{
+				{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555},
+				{Name: "Hystrix", Stars: 10248, Forks: 728, PRs: 0},
+				{Name: "security_monkey", Stars: 10047, Forks: 792, PRs: 55},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric+" "+string(tt.order), func(t *testing.T) {
+			backend := repoql.TopN{Client: client, Order: tt.order}
+			repos, err := backend.List(context.Background(), "netflix", 3, tt.metric)
+			if err != nil {
+				t.Fatalf(`List("netflix", 3, %q) failed: %v`, tt.metric, err)
+			}
+
+			if diff := cmp.Diff(tt.wantRepos, repos); diff != "" {
+				t.Errorf("List(\"netflix\", 3, %q) got diff (-want +got):\n%s", tt.metric, diff)
+			}
+		})
+	}
+}
+
+func TestListUser(t *testing.T) {
+	userRepos := []fakegithub.Repo{
+		{Name: "dotfiles", Stars: 3, Forks: 1, PRs: 2, HasIssues: true},
+		{Name: "blog", Stars: 10, Forks: 0, PRs: 4, HasIssues: true},
+	}
+	serv := fakegithub.NewGraphQLServer(t, fakegithub.Netflix(), fakegithub.WithUser("alice", userRepos))
+	defer serv.Close()
+	backend := repoql.TopN{Client: githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil)}
+
+	repos, err := backend.List(context.Background(), "alice", 3, "stars")
+	if err != nil {
+		t.Fatalf(`List("alice", 3, "stars") failed: %v`, err)
+	}
+
+	wantRepos := []*topn.Repo{
+		{Name: "blog", Stars: 10, Forks: 0, PRs: 4},
+		{Name: "dotfiles", Stars: 3, Forks: 1, PRs: 2},
+	}
+	if diff := cmp.Diff(wantRepos, repos); diff != "" {
+		t.Errorf(`List("alice", 3, "stars") got diff (-want +got):\n%s`, diff)
+	}
+}
+
+func TestListLargeOrg(t *testing.T) {
+	ctx := context.Background()
+
+	// More repos than GitHub's Search API will return for a single query.
+	const numRepos = 1050
+	serv := fakegithub.NewGraphQLServer(t, fakegithub.Generate(numRepos))
+	defer serv.Close()
+	client := githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil)
+	backend := repoql.TopN{Client: client}
+
+	tests := []struct {
+		desc      string
+		n         int
+		metric    string
+		wantRepos []*topn.Repo
+	}{
+		{
+			desc:   "top-3 repos by stars",
+			n:      3,
+			metric: "stars",
+			wantRepos: []*topn.Repo{
+				{Name: "repo-1049", Stars: 1049, Forks: 1, PRs: 2098},
+				{Name: "repo-1048", Stars: 1048, Forks: 2, PRs: 2096},
+				{Name: "repo-1047", Stars: 1047, Forks: 3, PRs: 2094},
+			},
+		},
+		{
+			desc:   "top-3 repos by forks",
+			n:      3,
+			metric: "forks",
+			wantRepos: []*topn.Repo{
+				{Name: "repo-0000", Stars: 0, Forks: 1050, PRs: 0},
+				{Name: "repo-0001", Stars: 1, Forks: 1049, PRs: 2},
+				{Name: "repo-0002", Stars: 2, Forks: 1048, PRs: 4},
+			},
+		},
+		{
+			desc:   "top-3 repos by prs",
+			n:      3,
+			metric: "prs",
+			wantRepos: []*topn.Repo{
+				{Name: "repo-1049", Stars: 1049, Forks: 1, PRs: 2098},
+				{Name: "repo-1048", Stars: 1048, Forks: 2, PRs: 2096},
+				{Name: "repo-1047", Stars: 1047, Forks: 3, PRs: 2094},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			repos, err := backend.List(ctx, "netflix", tt.n, tt.metric)
 			if err != nil {
 				t.Fatalf(`List("netflix", %d, %q) failed: %v`, tt.n, tt.metric, err)
 			}
@@ -302,4 +705,245 @@ func TestList(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("all repos", func(t *testing.T) {
+		repos, err := backend.List(ctx, "netflix", 9999, "stars")
+		if err != nil {
+			t.Fatalf(`List("netflix", 9999, "stars") failed: %v`, err)
+		}
+		if got := len(repos); got != numRepos {
+			t.Errorf(`List("netflix", 9999, "stars") returned %d repos, want %d`, got, numRepos)
+		}
+	})
+}
+
+func TestListRateLimited(t *testing.T) {
+	ctx := context.Background()
+
+	serv := fakegithub.NewGraphQLServer(t, fakegithub.Netflix(), fakegithub.WithRateLimit(2))
+	defer serv.Close()
+	client := githubv4.NewEnterpriseClient(serv.URL+"/graphql", &http.Client{Transport: &retry.Transport{
+		MaxRetries: 3,
+		BaseDelay:  time.Millisecond,
+	}})
+
+	backend := repoql.TopN{Client: client}
+	repos, err := backend.List(ctx, "netflix", 3, "prs")
+	if err != nil {
+		t.Fatalf(`List("netflix", 3, "prs") failed: %v`, err)
+	}
+
+	wantRepos := []*topn.Repo{
+		{Name: "SimianArmy", Stars: 0, Forks: 4253, PRs: 39811},
+		{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555},
+		{Name: "zuul", Stars: 0, Forks: 0, PRs: 2305},
+	}
+	if diff := cmp.Diff(wantRepos, repos); diff != "" {
+		t.Errorf(`List("netflix", 3, "prs") got diff (-want +got):\n%s`, diff)
+	}
+}
+
+func TestListConcurrent(t *testing.T) {
+	ctx := context.Background()
+
+	// Each org has more than one page of repos, all prefixed with the org's name,
+	// so interleaved pages from different orgs would be noticed.
+	const numOrgs = 10
+	var opts []fakegithub.Option
+	for i := 0; i < numOrgs; i++ {
+		org := fmt.Sprintf("org-%d", i)
+		repos := fakegithub.Generate(150)
+		for j := range repos {
+			repos[j].Name = org + "-" + repos[j].Name
+		}
+		opts = append(opts, fakegithub.WithOrg(org, repos))
+	}
+	serv := fakegithub.NewGraphQLServer(t, nil, opts...)
+	defer serv.Close()
+	client := githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil)
+	backend := repoql.TopN{Client: client}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5*numOrgs; i++ {
+		org := fmt.Sprintf("org-%d", i%numOrgs)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			repos, err := backend.List(ctx, org, 9999, "stars")
+			if err != nil {
+				t.Errorf("List(%q, 9999, \"stars\") failed: %v", org, err)
+				return
+			}
+			if got, want := len(repos), 150; got != want {
+				t.Errorf("List(%q, 9999, \"stars\") returned %d repos, want %d", org, got, want)
+			}
+			for _, r := range repos {
+				if !strings.HasPrefix(r.Name, org+"-repo-") {
+					t.Errorf("List(%q, 9999, \"stars\") returned repo %q from another org", org, r.Name)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestListWithStats(t *testing.T) {
+	tests := []struct {
+		desc      string
+		metric    string
+		filter    topn.Filter
+		wantStats repoql.Stats
+	}{
+		{
+			desc:      "page per query",
+			metric:    "stars",
+			wantStats: repoql.Stats{Queries: 3, Cost: 3, Remaining: 4997},
+		},
+		{
+			desc:   "nested connections cost more",
+			metric: "prs_opened",
+			filter: topn.Filter{Topic: "go"},
+			// Each page includes the topics and PRs opened connections.
+			wantStats: repoql.Stats{Queries: 3, Cost: 6, Remaining: 4994},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			serv := fakegithub.NewGraphQLServer(t, nil, fakegithub.WithOrg("large", fakegithub.Generate(250)))
+			defer serv.Close()
+			backend := repoql.TopN{
+				Client: githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil),
+				Window: fakegithub.Q4,
+				Filter: tt.filter,
+			}
+
+			_, stats, err := backend.ListWithStats(context.Background(), "large", 3, tt.metric)
+			if err != nil {
+				t.Fatalf(`ListWithStats("large", 3, %q) failed: %v`, tt.metric, err)
+			}
+
+			if stats.ResetAt.IsZero() {
+				t.Errorf(`ListWithStats("large", 3, %q) got zero ResetAt`, tt.metric)
+			}
+			stats.ResetAt = time.Time{}
+			if diff := cmp.Diff(tt.wantStats, stats); diff != "" {
+				t.Errorf(`ListWithStats("large", 3, %q) got stats diff (-want +got):\n%s`, tt.metric, diff)
+			}
+		})
+	}
+}
+
+func TestStatsAdd(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	tests := []struct {
+		desc  string
+		stats repoql.Stats
+		other repoql.Stats
+		want  repoql.Stats
+	}{
+		{
+			desc:  "to empty",
+			other: repoql.Stats{Queries: 2, Cost: 3, Remaining: 10, ResetAt: now},
+			want:  repoql.Stats{Queries: 2, Cost: 3, Remaining: 10, ResetAt: now},
+		},
+		{
+			desc:  "empty",
+			stats: repoql.Stats{Queries: 2, Cost: 3, Remaining: 10, ResetAt: now},
+			want:  repoql.Stats{Queries: 2, Cost: 3, Remaining: 10, ResetAt: now},
+		},
+		{
+			desc:  "least remaining",
+			stats: repoql.Stats{Queries: 2, Cost: 3, Remaining: 10, ResetAt: now},
+			other: repoql.Stats{Queries: 1, Cost: 1, Remaining: 20, ResetAt: now},
+			want:  repoql.Stats{Queries: 3, Cost: 4, Remaining: 10, ResetAt: now},
+		},
+		{
+			desc:  "later window",
+			stats: repoql.Stats{Queries: 2, Cost: 3, Remaining: 10, ResetAt: now},
+			other: repoql.Stats{Queries: 1, Cost: 1, Remaining: 4999, ResetAt: later},
+			want:  repoql.Stats{Queries: 3, Cost: 4, Remaining: 4999, ResetAt: later},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			tt.stats.Add(tt.other)
+			if diff := cmp.Diff(tt.want, tt.stats); diff != "" {
+				t.Errorf("Add() got diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		desc   string
+		org    string
+		metric string
+		filter topn.Filter
+		want   *repoql.Estimate
+	}{
+		{
+			desc:   "page per query",
+			org:    "large",
+			metric: "stars",
+			want:   &repoql.Estimate{Repos: 250, Pages: 3, PageCost: 1, Cost: 3, Remaining: 4999},
+		},
+		{
+			desc:   "nested connections cost more",
+			org:    "large",
+			metric: "prs_opened",
+			filter: topn.Filter{Topic: "go"},
+			want:   &repoql.Estimate{Repos: 250, Pages: 3, PageCost: 2, Cost: 6, Remaining: 4999},
+		},
+		{
+			desc:   "no repos",
+			org:    "empty",
+			metric: "stars",
+			want:   &repoql.Estimate{Pages: 1, PageCost: 1, Cost: 1, Remaining: 4999},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			serv := fakegithub.NewGraphQLServer(t, nil,
+				fakegithub.WithOrg("large", fakegithub.Generate(250)),
+				fakegithub.WithOrg("empty", nil))
+			defer serv.Close()
+			backend := repoql.TopN{
+				Client: githubv4.NewEnterpriseClient(serv.URL+"/graphql", nil),
+				Window: fakegithub.Q4,
+				Filter: tt.filter,
+			}
+
+			got, err := backend.Estimate(context.Background(), tt.org, tt.metric)
+			if err != nil {
+				t.Fatalf("Estimate(%q, %q) failed: %v", tt.org, tt.metric, err)
+			}
+
+			if got.ResetAt.IsZero() {
+				t.Errorf("Estimate(%q, %q) got zero ResetAt", tt.org, tt.metric)
+			}
+			got.ResetAt = time.Time{}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Estimate(%q, %q) got diff (-want +got):\n%s", tt.org, tt.metric, diff)
+			}
+		})
+	}
+}
+
+func TestMeasured(t *testing.T) {
+	backend := repoql.TopN{}
+	for metric, want := range map[string][]string{
+		"stars":  {"stars", "forks", "prs"},
+		"issues": {"stars", "forks", "prs", "issues"},
+	} {
+		if diff := cmp.Diff(want, backend.Measured(metric)); diff != "" {
+			t.Errorf("Measured(%q) got diff (-want +got):\n%s", metric, diff)
+		}
+	}
 }
@@ -0,0 +1,223 @@
+// Package retry implements an HTTP transport that retries GitHub API requests
+// that were rate limited, either waiting for the rate limit to reset or backing
+// off exponentially when GitHub doesn't say how long to wait.
+package retry
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vtsao/repon/internal/rewind"
+)
+
+const defaultBaseDelay = time.Second
+
+// Transport is an http.RoundTripper that retries requests rejected by GitHub's
+// primary and secondary (abuse) rate limits for both the REST and GraphQL APIs.
+type Transport struct {
+	// Base is the transport used to make requests. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+	// MaxRetries is the maximum number of times a rate limited request is
+	// retried before its response is returned as is.
+	MaxRetries int
+	// MaxWait is the longest we'll wait before retrying a request. If GitHub
+	// asks us to wait longer, the rate limited response is returned as is. Zero
+	// means there is no limit.
+	MaxWait time.Duration
+	// BaseDelay is the first delay used for exponential backoff when GitHub
+	// doesn't say how long to wait. If zero, one second is used.
+	BaseDelay time.Duration
+
+	mu sync.Mutex
+	// lowQuota is the tenth of the quota last seen remaining for each rate limit
+	// resource, so we only log when the remaining quota drops.
+	lowQuota map[string]int
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		r, err := rewind.Request(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.base().RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		t.logQuota(resp)
+
+		limited, wait, err := rateLimited(req, resp)
+		if err != nil {
+			return nil, err
+		}
+		if !limited || attempt >= t.MaxRetries {
+			return resp, nil
+		}
+		if wait <= 0 {
+			wait = t.backoff(attempt)
+		}
+		if t.MaxWait > 0 && wait > t.MaxWait {
+			log.Printf("Rate limited by %s, not retrying since waiting %s exceeds max wait of %s", req.URL.Host, wait, t.MaxWait)
+			return resp, nil
+		}
+
+		log.Printf("Rate limited by %s, retrying in %s (retry %d of %d)", req.URL.Host, wait, attempt+1, t.MaxRetries)
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the exponential backoff delay for the attempt.
+func (t *Transport) backoff(attempt int) time.Duration {
+	delay := t.BaseDelay
+	if delay <= 0 {
+		delay = defaultBaseDelay
+	}
+	return delay << uint(attempt)
+}
+
+// rateLimited returns whether resp was rejected by a rate limit and, if GitHub
+// told us, how long to wait before retrying.
+func rateLimited(req *http.Request, resp *http.Response) (bool, time.Duration, error) {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true, retryAfter(resp), nil
+	case http.StatusForbidden:
+		// Primary rate limit.
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			return true, untilReset(resp), nil
+		}
+		// Secondary (abuse) rate limits set Retry-After, but not always, so we also
+		// need to check the error message.
+		if resp.Header.Get("Retry-After") != "" {
+			return true, retryAfter(resp), nil
+		}
+		body, err := peekBody(resp)
+		if err != nil {
+			return false, 0, err
+		}
+		msg := strings.ToLower(string(body))
+		if strings.Contains(msg, "secondary rate limit") || strings.Contains(msg, "abuse detection") {
+			return true, 0, nil
+		}
+	case http.StatusOK:
+		// The GraphQL API returns rate limit errors with a 200 status.
+		if !strings.HasSuffix(req.URL.Path, "/graphql") {
+			return false, 0, nil
+		}
+		body, err := peekBody(resp)
+		if err != nil {
+			return false, 0, err
+		}
+		var gqlResp struct {
+			Errors []struct {
+				Type string `json:"type"`
+			} `json:"errors"`
+		}
+		// Non-JSON responses aren't our concern, the GraphQL client will report
+		// them.
+		if err := json.Unmarshal(body, &gqlResp); err != nil {
+			return false, 0, nil
+		}
+		for _, e := range gqlResp.Errors {
+			if e.Type == "RATE_LIMITED" {
+				return true, untilReset(resp), nil
+			}
+		}
+	}
+	return false, 0, nil
+}
+
+// peekBody reads resp's body and replaces it so it can be read again.
+func peekBody(resp *http.Response) ([]byte, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// retryAfter returns the delay from resp's Retry-After header, which is either
+// in seconds or an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// untilReset returns how long until the rate limit resets according to resp's
+// X-RateLimit-Reset header, which is in UTC epoch seconds.
+func untilReset(resp *http.Response) time.Duration {
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Until(time.Unix(reset, 0))
+}
+
+// logQuota logs the remaining rate limit quota from resp's headers each time it
+// drops below another tenth of the limit.
+func (t *Transport) logQuota(resp *http.Response) {
+	limit, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	if err != nil || limit <= 0 {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	resource := resp.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+	tenth := remaining * 10 / limit
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.lowQuota == nil {
+		t.lowQuota = make(map[string]int)
+	}
+	last, ok := t.lowQuota[resource]
+	t.lowQuota[resource] = tenth
+	if ok && tenth >= last {
+		return
+	}
+	if ok || tenth < 5 {
+		log.Printf("GitHub %s rate limit: %d of %d remaining, resets in %s", resource, remaining, limit, untilReset(resp).Round(time.Second))
+	}
+}
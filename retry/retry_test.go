@@ -0,0 +1,189 @@
+package retry_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vtsao/repon/retry"
+)
+
+// flakyServ creates a server that responds with limited for the first failures
+// requests and then succeeds. It also records the body of every request.
+func flakyServ(t *testing.T, failures int, limited func(w http.ResponseWriter)) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var bodies []string
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("ReadAll() failed: %v", err)
+		}
+
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		count := len(bodies)
+		mu.Unlock()
+
+		if count <= failures {
+			limited(w)
+			return
+		}
+		io.WriteString(w, `{"data": "ok"}`)
+	}))
+
+	return serv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func primaryRateLimit(reset time.Time) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"message": "API rate limit exceeded"}`)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		desc       string
+		path       string
+		failures   int
+		limited    func(w http.ResponseWriter)
+		maxRetries int
+		maxWait    time.Duration
+		wantStatus int
+		wantCalls  int
+	}{
+		{
+			desc:       "primary rate limit",
+			failures:   1,
+			limited:    primaryRateLimit(time.Now()),
+			maxRetries: 3,
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			desc:     "secondary rate limit with Retry-After",
+			failures: 2,
+			limited: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			maxRetries: 3,
+			wantStatus: http.StatusOK,
+			wantCalls:  3,
+		},
+		{
+			desc:     "secondary rate limit without Retry-After",
+			failures: 1,
+			limited: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusForbidden)
+				io.WriteString(w, `{"message": "You have exceeded a secondary rate limit."}`)
+			},
+			maxRetries: 3,
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			desc:     "graphql rate limit",
+			path:     "/graphql",
+			failures: 1,
+			limited: func(w http.ResponseWriter) {
+				io.WriteString(w, `{"errors": [{"type": "RATE_LIMITED", "message": "API rate limit exceeded"}]}`)
+			},
+			maxRetries: 3,
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			desc:     "forbidden but not rate limited",
+			failures: 1,
+			limited: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusForbidden)
+				io.WriteString(w, `{"message": "Must have admin rights to Repository."}`)
+			},
+			maxRetries: 3,
+			wantStatus: http.StatusForbidden,
+			wantCalls:  1,
+		},
+		{
+			desc:       "exceeds max retries",
+			failures:   5,
+			limited:    primaryRateLimit(time.Now()),
+			maxRetries: 2,
+			wantStatus: http.StatusForbidden,
+			wantCalls:  3,
+		},
+		{
+			desc:       "reset exceeds max wait",
+			failures:   1,
+			limited:    primaryRateLimit(time.Now().Add(time.Hour)),
+			maxRetries: 3,
+			maxWait:    time.Minute,
+			wantStatus: http.StatusForbidden,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			serv, bodies := flakyServ(t, tt.failures, tt.limited)
+			defer serv.Close()
+
+			client := &http.Client{Transport: &retry.Transport{
+				MaxRetries: tt.maxRetries,
+				MaxWait:    tt.maxWait,
+				BaseDelay:  time.Millisecond,
+			}}
+			const body = `{"query": "query{viewer{login}}"}`
+			resp, err := client.Post(serv.URL+tt.path, "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Post() failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Post() got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			got := bodies()
+			if len(got) != tt.wantCalls {
+				t.Errorf("Post() made %d requests, want %d", len(got), tt.wantCalls)
+			}
+			for i, b := range got {
+				if b != body {
+					t.Errorf("Post() request %d got body %q, want %q", i, b, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRoundTripCanceled(t *testing.T) {
+	serv, _ := flakyServ(t, 1, primaryRateLimit(time.Now().Add(time.Hour)))
+	defer serv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serv.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequestWithContext() failed: %v", err)
+	}
+
+	client := &http.Client{Transport: &retry.Transport{MaxRetries: 3}}
+	if _, err := client.Do(req); err == nil {
+		t.Error("Do() succeeded, want error after context deadline")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/vtsao/repon/exporter"
+	"github.com/vtsao/repon/ghclient"
+	"github.com/vtsao/repon/repoql"
+	"github.com/vtsao/repon/server"
+)
+
+// shutdownTimeout is how long repon serve and repon exporter wait for requests
+// in flight to finish when they're stopped.
+const shutdownTimeout = 30 * time.Second
+
+// serve runs "repon serve", which serves the top-n repos of any organization or
+// user over HTTP until it's interrupted or terminated.
+func serve(client *http.Client) {
+	orgBackend, userBackend := backends(client)
+	log.Printf("Serving top-n repos on %s", *addr)
+	listenAndServe(&server.Server{
+		Orgs:    orgBackend,
+		Users:   userBackend,
+		Window:  window,
+		Score:   score,
+		MaxN:    *maxN,
+		Timeout: *requestTimeout,
+		TTL:     *responseTTL,
+	})
+}
+
+// export runs "repon exporter", which refreshes the metrics of every repo of
+// --org and --user every --refresh_interval and serves them to Prometheus on
+// /metrics until it's interrupted or terminated.
+func export(client *http.Client) {
+	log.Print("Using GitHub GraphQL API")
+	e := &exporter.Exporter{
+		Lister: &repoql.TopN{Client: ghclient.NewGraphQL(client, *graphQLURL), Filter: filter},
+		Owners: append(splitList(*org), splitList(*user)...),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx, *refreshInterval)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	log.Printf("Serving metrics on %s/metrics", *addr)
+	listenAndServe(mux)
+}
+
+// listenAndServe serves handler on --addr until SIGINT or SIGTERM, then waits
+// for requests in flight to finish.
+func listenAndServe(handler http.Handler) {
+	srv := &http.Server{Addr: *addr, Handler: handler}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		sig := <-stop
+		log.Printf("Received %s, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Error waiting for requests to finish: %v", err)
+		}
+		close(done)
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatalf("Error serving on --addr: %v", err)
+	}
+	<-done
+}
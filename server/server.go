@@ -0,0 +1,242 @@
+// Package server serves the top-n repos of GitHub organizations and users over
+// HTTP, so dashboards can query rankings instead of running repon themselves.
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/vtsao/repon/format"
+	"github.com/vtsao/repon/topn"
+)
+
+const (
+	defaultN      = 10
+	defaultMetric = "stars"
+	defaultFormat = "json"
+)
+
+// contentTypes are the content types of the formats repos are served in.
+var contentTypes = map[string]string{
+	"text":     "text/plain; charset=utf-8",
+	"json":     "application/json; charset=utf-8",
+	"csv":      "text/csv; charset=utf-8",
+	"tsv":      "text/tab-separated-values; charset=utf-8",
+	"markdown": "text/markdown; charset=utf-8",
+}
+
+// Server is an http.Handler that serves the top-n repos of an owner:
+//
+//	GET /orgs/{org}/top?n=10&metric=stars&format=json
+//	GET /users/{user}/top?n=10&metric=stars&format=json
+//
+// n, metric and format are optional and default to 10, stars and json. Each
+// response is cached for TTL, so repeated requests don't list the owner's repos
+// again.
+type Server struct {
+	// Orgs lists the repos of organizations.
+	Orgs topn.Backend
+	// Users lists the repos of user accounts.
+	Users topn.Backend
+	// Window is the time window the backends count windowed metrics in.
+	// Windowed metrics are rejected if it has no start.
+	Window topn.Window
+	// Score is the composite score the backends rank repos by for the "score"
+	// metric, which is rejected if it's nil.
+	Score *topn.Score
+	// MaxN is the largest n that can be requested. Zero means there is no
+	// limit.
+	MaxN int
+	// Timeout is how long listing an owner's repos can take before the request
+	// fails. Zero means there is no limit beyond the request's own context.
+	Timeout time.Duration
+	// TTL is how long responses are cached. Zero means they aren't cached.
+	TTL time.Duration
+
+	initOnce sync.Once
+	router   *mux.Router
+	mu       sync.Mutex
+	cache    map[string]*response
+}
+
+// response is a cached response.
+type response struct {
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// query is a validated request for an owner's top-n repos.
+type query struct {
+	backend topn.Backend
+	owner   string
+	n       int
+	metric  string
+	format  string
+}
+
+// key returns the key the query's response is cached under. Logins are case
+// insensitive, so they're lower cased.
+func (q *query) key(endpoint string) string {
+	return strings.Join([]string{endpoint, strings.ToLower(q.owner), strconv.Itoa(q.n), q.metric, q.format}, "\n")
+}
+
+func (s *Server) init() {
+	s.router = mux.NewRouter()
+	s.router.HandleFunc("/orgs/{owner}/top", s.handleTop("orgs")).Methods(http.MethodGet)
+	s.router.HandleFunc("/users/{owner}/top", s.handleTop("users")).Methods(http.MethodGet)
+	s.cache = make(map[string]*response)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.initOnce.Do(s.init)
+	s.router.ServeHTTP(w, r)
+}
+
+// handleTop returns a handler for the top-n repos of the endpoint's owners,
+// either "orgs" or "users".
+func (s *Server) handleTop(endpoint string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		backend := s.Orgs
+		if endpoint == "users" {
+			backend = s.Users
+		}
+		q, err := s.parseQuery(r, backend)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		key := q.key(endpoint)
+		resp, ok := s.cached(key)
+		if !ok {
+			resp, err = s.list(r.Context(), q)
+			if err != nil {
+				log.Printf("Error listing top %d repos for %q by %q: %v", q.n, q.owner, q.metric, err)
+				status := http.StatusBadGateway
+				if err == context.DeadlineExceeded {
+					status = http.StatusGatewayTimeout
+				}
+				http.Error(w, fmt.Sprintf("listing top %d repos for %q by %q: %v", q.n, q.owner, q.metric, err), status)
+				return
+			}
+			s.store(key, resp)
+		}
+
+		w.Header().Set("Content-Type", resp.contentType)
+		w.Write(resp.body)
+	}
+}
+
+// parseQuery parses and validates the request's owner and query parameters,
+// including whether the backend that lists the owner's repos supports the
+// metric.
+func (s *Server) parseQuery(r *http.Request, backend topn.Backend) (*query, error) {
+	params := r.URL.Query()
+	q := &query{backend: backend, owner: mux.Vars(r)["owner"], n: defaultN, metric: defaultMetric, format: defaultFormat}
+
+	if v := params.Get("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("n must be a positive integer, got %q", v)
+		}
+		if s.MaxN > 0 && n > s.MaxN {
+			return nil, fmt.Errorf("n must be at most %d, got %d", s.MaxN, n)
+		}
+		q.n = n
+	}
+
+	if v := params.Get("metric"); v != "" {
+		q.metric = v
+	}
+	if _, ok := topn.LookupMetric(q.metric); !ok {
+		return nil, fmt.Errorf("metric must be one of %q, got %q", topn.MetricNames(), q.metric)
+	}
+	components, err := topn.Components(q.metric, s.Score)
+	if err != nil {
+		return nil, err
+	}
+	if s.Window.Since.IsZero() {
+		for _, c := range components {
+			if cm, _ := topn.LookupMetric(c); cm.Windowed {
+				return nil, fmt.Errorf("metric %q is windowed, but the server has no time window", q.metric)
+			}
+		}
+	}
+	if c, ok := backend.(topn.MetricChecker); ok {
+		if err := c.CheckMetric(q.metric); err != nil {
+			return nil, err
+		}
+	}
+
+	if v := params.Get("format"); v != "" {
+		q.format = v
+	}
+	if !format.Supported(q.format) {
+		return nil, fmt.Errorf("format must be one of %q, got %q", format.Formats(), q.format)
+	}
+	return q, nil
+}
+
+// list lists the query's repos and formats them as a response. ctx is the
+// request's context, so listing stops if the client goes away.
+func (s *Server) list(ctx context.Context, q *query) (*response, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	repos, err := q.backend.List(ctx, q.owner, q.n, q.metric)
+	if err != nil {
+		// Backends wrap errors, so a timeout is recognized by the context.
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := format.Write(&buf, q.format, repos, q.metric, q.backend.Measured(q.metric)); err != nil {
+		return nil, err
+	}
+	return &response{contentType: contentTypes[q.format], body: buf.Bytes()}, nil
+}
+
+// cached returns the response cached under key, if it hasn't expired.
+func (s *Server) cached(key string) (*response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp, ok := s.cache[key]
+	if !ok || !time.Now().Before(resp.expires) {
+		return nil, false
+	}
+	return resp, true
+}
+
+// store caches resp under key for TTL, dropping any expired responses so the
+// cache doesn't grow with every query ever made.
+func (s *Server) store(key string, resp *response) {
+	if s.TTL <= 0 {
+		return
+	}
+	now := time.Now()
+	resp.expires = now.Add(s.TTL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, r := range s.cache {
+		if !now.Before(r.expires) {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = resp
+}
@@ -0,0 +1,331 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/server"
+	"github.com/vtsao/repon/topn"
+)
+
+// fakeBackend returns the same repos for every owner, ranked by stars, and
+// records every call to List.
+type fakeBackend struct {
+	repos []*topn.Repo
+	err   error
+	// block makes List wait until its context is done.
+	block bool
+	// unsupported are the metrics CheckMetric rejects.
+	unsupported map[string]bool
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (b *fakeBackend) List(ctx context.Context, org string, n int, metric string) ([]*topn.Repo, error) {
+	b.mu.Lock()
+	b.calls = append(b.calls, org+" "+metric)
+	b.mu.Unlock()
+
+	if b.block {
+		<-ctx.Done()
+		return nil, errors.New("listing repos: " + ctx.Err().Error())
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if n > len(b.repos) {
+		n = len(b.repos)
+	}
+	return b.repos[:n], nil
+}
+
+func (b *fakeBackend) Measured(metric string) []string {
+	return []string{"stars", "forks", "prs", metric}
+}
+
+func (b *fakeBackend) CheckMetric(metric string) error {
+	if b.unsupported[metric] {
+		return fmt.Errorf("metric %q isn't supported", metric)
+	}
+	return nil
+}
+
+func (b *fakeBackend) Calls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.calls...)
+}
+
+var repos = []*topn.Repo{
+	{Name: "Hystrix", Stars: 21700, Forks: 4400, PRs: 1039},
+	{Name: "zuul", Stars: 10800, Forks: 2100, PRs: 569},
+	{Name: "eureka", Stars: 10400, Forks: 3100, PRs: 618},
+}
+
+type response struct {
+	status      int
+	contentType string
+	body        string
+}
+
+func get(t *testing.T, serv *httptest.Server, path string) response {
+	t.Helper()
+	resp, err := http.Get(serv.URL + path)
+	if err != nil {
+		t.Fatalf("Get(%q) failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Reading body of %q failed: %v", path, err)
+	}
+	return response{status: resp.StatusCode, contentType: resp.Header.Get("Content-Type"), body: string(b)}
+}
+
+func TestServeHTTP(t *testing.T) {
+	tests := []struct {
+		desc      string
+		path      string
+		want      response
+		wantOrgs  []string
+		wantUsers []string
+	}{
+		{
+			desc: "defaults",
+			path: "/orgs/netflix/top",
+			want: response{
+				status:      http.StatusOK,
+				contentType: "application/json; charset=utf-8",
+				body: `[
+  {
+    "rank": 1,
+    "name": "Hystrix",
+    "stars": 21700,
+    "forks": 4400,
+    "prs": 1039
+  },
+  {
+    "rank": 2,
+    "name": "zuul",
+    "stars": 10800,
+    "forks": 2100,
+    "prs": 569
+  },
+  {
+    "rank": 3,
+    "name": "eureka",
+    "stars": 10400,
+    "forks": 3100,
+    "prs": 618
+  }
+]
+`,
+			},
+			wantOrgs: []string{"netflix stars"},
+		},
+		{
+			desc: "text",
+			path: "/orgs/netflix/top?n=2&metric=forks&format=text",
+			want: response{
+				status:      http.StatusOK,
+				contentType: "text/plain; charset=utf-8",
+				body: `1) repo: "Hystrix", forks: 4400
+2) repo: "zuul", forks: 2100
+`,
+			},
+			wantOrgs: []string{"netflix forks"},
+		},
+		{
+			desc: "user",
+			path: "/users/octocat/top?n=1&format=csv",
+			want: response{
+				status:      http.StatusOK,
+				contentType: "text/csv; charset=utf-8",
+				body:        "rank,name,stars,forks,prs\n1,Hystrix,21700,4400,1039\n",
+			},
+			wantUsers: []string{"octocat stars"},
+		},
+		{
+			desc: "invalid n",
+			path: "/orgs/netflix/top?n=0",
+			want: response{
+				status:      http.StatusBadRequest,
+				contentType: "text/plain; charset=utf-8",
+				body:        "n must be a positive integer, got \"0\"\n",
+			},
+		},
+		{
+			desc: "n over max",
+			path: "/orgs/netflix/top?n=101",
+			want: response{
+				status:      http.StatusBadRequest,
+				contentType: "text/plain; charset=utf-8",
+				body:        "n must be at most 100, got 101\n",
+			},
+		},
+		{
+			desc: "unsupported format",
+			path: "/orgs/netflix/top?format=xml",
+			want: response{
+				status:      http.StatusBadRequest,
+				contentType: "text/plain; charset=utf-8",
+				body:        "format must be one of [\"csv\" \"json\" \"markdown\" \"text\" \"tsv\"], got \"xml\"\n",
+			},
+		},
+		{
+			desc: "windowed metric without window",
+			path: "/orgs/netflix/top?metric=prs_merged",
+			want: response{
+				status:      http.StatusBadRequest,
+				contentType: "text/plain; charset=utf-8",
+				body:        "metric \"prs_merged\" is windowed, but the server has no time window\n",
+			},
+		},
+		{
+			desc: "score without weights",
+			path: "/orgs/netflix/top?metric=score",
+			want: response{
+				status:      http.StatusBadRequest,
+				contentType: "text/plain; charset=utf-8",
+				body:        "metric \"score\" requires weights\n",
+			},
+		},
+		{
+			desc: "metric unsupported by backend",
+			path: "/orgs/netflix/top?metric=contributors",
+			want: response{
+				status:      http.StatusBadRequest,
+				contentType: "text/plain; charset=utf-8",
+				body:        "metric \"contributors\" isn't supported\n",
+			},
+		},
+		{
+			desc: "unknown path",
+			path: "/repos/netflix/top",
+			want: response{
+				status:      http.StatusNotFound,
+				contentType: "text/plain; charset=utf-8",
+				body:        "404 page not found\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			unsupported := map[string]bool{"contributors": true}
+			orgs, users := &fakeBackend{repos: repos, unsupported: unsupported}, &fakeBackend{repos: repos, unsupported: unsupported}
+			serv := httptest.NewServer(&server.Server{Orgs: orgs, Users: users, MaxN: 100})
+			defer serv.Close()
+
+			got := get(t, serv, tt.path)
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(response{})); diff != "" {
+				t.Errorf("Get(%q) got diff (-want +got):\n%s", tt.path, diff)
+			}
+			if diff := cmp.Diff(tt.wantOrgs, orgs.Calls()); diff != "" {
+				t.Errorf("Get(%q) got orgs backend calls diff (-want +got):\n%s", tt.path, diff)
+			}
+			if diff := cmp.Diff(tt.wantUsers, users.Calls()); diff != "" {
+				t.Errorf("Get(%q) got users backend calls diff (-want +got):\n%s", tt.path, diff)
+			}
+		})
+	}
+}
+
+func TestServeHTTPCache(t *testing.T) {
+	tests := []struct {
+		desc      string
+		ttl       time.Duration
+		paths     []string
+		wantCalls []string
+	}{
+		{
+			desc:      "cached",
+			ttl:       time.Hour,
+			paths:     []string{"/orgs/netflix/top", "/orgs/Netflix/top?n=10&metric=stars&format=json"},
+			wantCalls: []string{"netflix stars"},
+		},
+		{
+			desc:      "cached by query",
+			ttl:       time.Hour,
+			paths:     []string{"/orgs/netflix/top", "/orgs/netflix/top?metric=forks", "/orgs/netflix/top?format=text", "/orgs/netflix/top?metric=forks"},
+			wantCalls: []string{"netflix stars", "netflix forks", "netflix stars"},
+		},
+		{
+			desc:      "cached by endpoint",
+			ttl:       time.Hour,
+			paths:     []string{"/orgs/netflix/top", "/users/netflix/top"},
+			wantCalls: []string{"netflix stars", "netflix stars"},
+		},
+		{
+			desc:      "no ttl",
+			paths:     []string{"/orgs/netflix/top", "/orgs/netflix/top"},
+			wantCalls: []string{"netflix stars", "netflix stars"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			// Both endpoints share a backend to see every call in order.
+			backend := &fakeBackend{repos: repos}
+			serv := httptest.NewServer(&server.Server{Orgs: backend, Users: backend, TTL: tt.ttl})
+			defer serv.Close()
+
+			for _, path := range tt.paths {
+				if got := get(t, serv, path); got.status != http.StatusOK {
+					t.Fatalf("Get(%q) got status %d, want %d", path, got.status, http.StatusOK)
+				}
+			}
+			if diff := cmp.Diff(tt.wantCalls, backend.Calls()); diff != "" {
+				t.Errorf("Get(%q) got backend calls diff (-want +got):\n%s", tt.paths, diff)
+			}
+		})
+	}
+}
+
+func TestServeHTTPErrors(t *testing.T) {
+	tests := []struct {
+		desc       string
+		backend    *fakeBackend
+		wantStatus int
+		wantCalls  int
+	}{
+		{
+			desc:       "backend error",
+			backend:    &fakeBackend{err: errors.New("GitHub is down")},
+			wantStatus: http.StatusBadGateway,
+			// Errors aren't cached.
+			wantCalls: 2,
+		},
+		{
+			desc:       "timeout",
+			backend:    &fakeBackend{block: true},
+			wantStatus: http.StatusGatewayTimeout,
+			wantCalls:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			serv := httptest.NewServer(&server.Server{Orgs: tt.backend, Timeout: 10 * time.Millisecond, TTL: time.Hour})
+			defer serv.Close()
+
+			for i := 0; i < 2; i++ {
+				if got := get(t, serv, "/orgs/netflix/top"); got.status != tt.wantStatus {
+					t.Errorf("Get() got status %d, want %d", got.status, tt.wantStatus)
+				}
+			}
+			if got := len(tt.backend.Calls()); got != tt.wantCalls {
+				t.Errorf("Get() got %d backend calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
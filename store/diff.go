@@ -0,0 +1,211 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vtsao/repon/topn"
+)
+
+// ErrNoSnapshots is returned by Pair if there aren't two snapshots to compare.
+var ErrNoSnapshots = errors.New("need two snapshots to compare")
+
+// Diff is how an owner's ranked repos changed between two snapshots.
+type Diff struct {
+	Owner  string    `json:"owner"`
+	Metric string    `json:"metric"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Repos are the repos ranked in the newer snapshot in rank order, followed
+	// by the repos that left the ranking in their old rank order.
+	Repos []RepoDiff `json:"repos"`
+}
+
+// RepoDiff is how a repo's rank and metrics changed between two snapshots.
+type RepoDiff struct {
+	Name string `json:"name"`
+	// OldRank and NewRank are the repo's rank in the older and newer snapshot,
+	// or 0 if it wasn't ranked in it.
+	OldRank int `json:"old_rank,omitempty"`
+	NewRank int `json:"new_rank,omitempty"`
+	// Deltas are the changes in the repo's metrics, if it's ranked in both.
+	Deltas []Delta `json:"deltas,omitempty"`
+}
+
+// Entered returns whether the repo entered the ranking.
+func (r *RepoDiff) Entered() bool {
+	return r.OldRank == 0
+}
+
+// Left returns whether the repo left the ranking.
+func (r *RepoDiff) Left() bool {
+	return r.NewRank == 0
+}
+
+// Moved returns how many ranks the repo moved up, or down if negative.
+func (r *RepoDiff) Moved() int {
+	if r.Entered() || r.Left() {
+		return 0
+	}
+	return r.OldRank - r.NewRank
+}
+
+// Delta is the change in a repo's metric.
+type Delta struct {
+	Metric string  `json:"metric"`
+	Old    float64 `json:"old"`
+	New    float64 `json:"new"`
+	// Change is New - Old.
+	Change float64 `json:"change"`
+	// Percent is Change as a percentage of Old, or nil if Old is 0.
+	Percent *float64 `json:"percent,omitempty"`
+}
+
+// Compare returns how the ranked repos changed from the old snapshot to the
+// new one, which must be of the same owner listed with the same backend and
+// ranked by the same metric in the same order. Only metrics measured in both
+// snapshots are compared.
+func Compare(old, new *Snapshot) (*Diff, error) {
+	if !strings.EqualFold(old.Owner, new.Owner) {
+		return nil, fmt.Errorf("snapshots are of different owners %q and %q", old.Owner, new.Owner)
+	}
+	// Backends measure metrics differently, e.g. only GraphQL always counts PRs.
+	if old.Backend != new.Backend {
+		return nil, fmt.Errorf("snapshots were listed with different backends %q and %q", old.Backend, new.Backend)
+	}
+	if old.Metric != new.Metric || old.Order != new.Order {
+		return nil, fmt.Errorf("snapshots are ranked differently, by %q %s and %q %s", old.Metric, order(old), new.Metric, order(new))
+	}
+	// Repos entering or leaving a top-n of a different size aren't changes.
+	if old.N != new.N {
+		return nil, fmt.Errorf("snapshots are of different top-n, %d and %d", old.N, new.N)
+	}
+
+	d := &Diff{Owner: new.Owner, Metric: new.Metric, From: old.Time, To: new.Time, Repos: []RepoDiff{}}
+	metrics := measuredInBoth(old, new)
+	oldRepos := make(map[string]*topn.Repo)
+	oldRanks := make(map[string]int)
+	for i, r := range old.TopN() {
+		oldRepos[r.Name] = r
+		oldRanks[r.Name] = i + 1
+	}
+	ranked := make(map[string]bool)
+	for i, r := range new.TopN() {
+		ranked[r.Name] = true
+		rd := RepoDiff{Name: r.Name, OldRank: oldRanks[r.Name], NewRank: i + 1}
+		if o, ok := oldRepos[r.Name]; ok {
+			rd.Deltas = deltas(o, r, metrics)
+		}
+		d.Repos = append(d.Repos, rd)
+	}
+	for _, r := range old.Repos {
+		if !ranked[r.Name] {
+			d.Repos = append(d.Repos, RepoDiff{Name: r.Name, OldRank: oldRanks[r.Name]})
+		}
+	}
+	return d, nil
+}
+
+// order returns the snapshot's order, which is descending if unset.
+func order(s *Snapshot) topn.Order {
+	if s.Order == "" {
+		return topn.Descending
+	}
+	return s.Order
+}
+
+// measuredInBoth returns the metrics measured in both old and new: stars,
+// forks and PRs, followed by the additional metrics sorted by name.
+func measuredInBoth(old, new *Snapshot) []string {
+	inOld := make(map[string]bool)
+	for _, name := range old.MeasuredMetrics() {
+		inOld[name] = true
+	}
+	inBoth := make(map[string]bool)
+	var extra []string
+	for _, name := range new.MeasuredMetrics() {
+		if !inOld[name] || inBoth[name] {
+			continue
+		}
+		inBoth[name] = true
+		if name != "stars" && name != "forks" && name != "prs" {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+
+	var names []string
+	for _, name := range []string{"stars", "forks", "prs"} {
+		if inBoth[name] {
+			names = append(names, name)
+		}
+	}
+	return append(names, extra...)
+}
+
+// deltas returns the changes in the metrics between old and new.
+func deltas(old, new *topn.Repo, metrics []string) []Delta {
+	var ds []Delta
+	for _, name := range metrics {
+		value := func(r *topn.Repo) float64 { return r.Metrics[name] }
+		if m, ok := topn.LookupMetric(name); ok {
+			value = m.Value
+		}
+		d := Delta{Metric: name, Old: value(old), New: value(new)}
+		d.Change = d.New - d.Old
+		if d.Old != 0 {
+			percent := d.Change / d.Old * 100
+			d.Percent = &percent
+		}
+		ds = append(ds, d)
+	}
+	return ds
+}
+
+// Pair picks the snapshots to compare from snaps, which are in the order they
+// were stored. The newer snapshot is the last one stored at or before to, or
+// the last one if to is zero. The older snapshot is the last one of the same
+// top-n listed with the same backend and ranked the same way stored at or
+// before from, or before the newer snapshot if from is zero. Only snapshots
+// ranked by metric are considered, or by the newest snapshot's metric if it's
+// empty.
+func Pair(snaps []*Snapshot, metric string, from, to time.Time) (old, new *Snapshot, err error) {
+	var candidates []*Snapshot
+	for _, s := range snaps {
+		if metric == "" || s.Metric == metric {
+			candidates = append(candidates, s)
+		}
+	}
+
+	// Snapshots are stored in time order, unless the clock went backwards.
+	last := func(before time.Time, match func(*Snapshot) bool) int {
+		for i := len(candidates) - 1; i >= 0; i-- {
+			if (before.IsZero() || !candidates[i].Time.After(before)) && match(candidates[i]) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	i := last(to, func(*Snapshot) bool { return true })
+	if i < 0 {
+		return nil, nil, ErrNoSnapshots
+	}
+	new = candidates[i]
+	// Snapshots listed with different backends or of a different top-n aren't
+	// comparable either.
+	sameRanking := func(s *Snapshot) bool {
+		return s.Metric == new.Metric && order(s) == order(new) && s.Backend == new.Backend && s.N == new.N
+	}
+	if from.IsZero() {
+		candidates = candidates[:i]
+	}
+	j := last(from, sameRanking)
+	if j < 0 || j >= i {
+		return nil, nil, ErrNoSnapshots
+	}
+	return candidates[j], new, nil
+}
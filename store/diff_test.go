@@ -0,0 +1,234 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/store"
+	"github.com/vtsao/repon/topn"
+)
+
+func percent(p float64) *float64 {
+	return &p
+}
+
+func TestCompare(t *testing.T) {
+	monday := time.Date(2020, 12, 21, 9, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+	old := store.NewSnapshot(monday, "netflix", "graphql", "stars", "", 3, []string{"stars", "forks", "prs"}, []*topn.Repo{
+		{Name: "metaflow", Stars: 200, Forks: 20, PRs: 10},
+		{Name: "Hystrix", Stars: 100, Forks: 0, PRs: 5},
+		{Name: "zuul", Stars: 50, Forks: 5, PRs: 1},
+	})
+	new := store.NewSnapshot(tuesday, "Netflix", "graphql", "stars", "", 3, []string{"stars", "forks", "prs"}, []*topn.Repo{
+		{Name: "Hystrix", Stars: 300, Forks: 3, PRs: 5},
+		{Name: "metaflow", Stars: 210, Forks: 19, PRs: 10},
+		{Name: "chaosmonkey", Stars: 60, Forks: 1, PRs: 0},
+	})
+
+	got, err := store.Compare(old, new)
+	if err != nil {
+		t.Fatalf("Compare() failed: %v", err)
+	}
+
+	want := &store.Diff{
+		Owner:  "Netflix",
+		Metric: "stars",
+		From:   monday,
+		To:     tuesday,
+		Repos: []store.RepoDiff{
+			{
+				Name: "Hystrix", OldRank: 2, NewRank: 1,
+				Deltas: []store.Delta{
+					{Metric: "stars", Old: 100, New: 300, Change: 200, Percent: percent(200)},
+					// Percentages of 0 are undefined.
+					{Metric: "forks", Old: 0, New: 3, Change: 3},
+					{Metric: "prs", Old: 5, New: 5, Change: 0, Percent: percent(0)},
+				},
+			},
+			{
+				Name: "metaflow", OldRank: 1, NewRank: 2,
+				Deltas: []store.Delta{
+					{Metric: "stars", Old: 200, New: 210, Change: 10, Percent: percent(5)},
+					{Metric: "forks", Old: 20, New: 19, Change: -1, Percent: percent(-5)},
+					{Metric: "prs", Old: 10, New: 10, Change: 0, Percent: percent(0)},
+				},
+			},
+			{Name: "chaosmonkey", NewRank: 3},
+			{Name: "zuul", OldRank: 3},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Compare() got diff (-want +got):\n%s", diff)
+	}
+
+	var moved []int
+	for _, r := range got.Repos {
+		moved = append(moved, r.Moved())
+	}
+	if diff := cmp.Diff([]int{1, -1, 0, 0}, moved); diff != "" {
+		t.Errorf("Moved() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompareExtraMetrics(t *testing.T) {
+	now := time.Now()
+	old := store.NewSnapshot(now, "netflix", "graphql", "score", "", 1, []string{"stars", "forks", "prs", "contribs", "score"}, []*topn.Repo{
+		{Name: "zuul", Metrics: map[string]float64{"score": 0.5, "contribs": 0.25}},
+	})
+	new := store.NewSnapshot(now, "netflix", "graphql", "score", "", 1, []string{"stars", "forks", "issues", "score"}, []*topn.Repo{
+		{Name: "zuul", Metrics: map[string]float64{"score": 0.75, "issues": 3}},
+	})
+
+	got, err := store.Compare(old, new)
+	if err != nil {
+		t.Fatalf("Compare() failed: %v", err)
+	}
+
+	// Only metrics measured in both snapshots have deltas.
+	want := []store.Delta{
+		{Metric: "stars"},
+		{Metric: "forks"},
+		{Metric: "score", Old: 0.5, New: 0.75, Change: 0.25, Percent: percent(50)},
+	}
+	if diff := cmp.Diff(want, got.Repos[0].Deltas); diff != "" {
+		t.Errorf("Compare() got deltas diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompareMismatch(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		desc     string
+		old, new *store.Snapshot
+	}{
+		{
+			desc: "owners",
+			old:  store.NewSnapshot(now, "netflix", "graphql", "stars", "", 1, nil, nil),
+			new:  store.NewSnapshot(now, "spinnaker", "graphql", "stars", "", 1, nil, nil),
+		},
+		{
+			desc: "backends",
+			old:  store.NewSnapshot(now, "netflix", "graphql", "stars", "", 1, nil, nil),
+			new:  store.NewSnapshot(now, "netflix", "rest", "stars", "", 1, nil, nil),
+		},
+		{
+			desc: "metrics",
+			old:  store.NewSnapshot(now, "netflix", "graphql", "stars", "", 1, nil, nil),
+			new:  store.NewSnapshot(now, "netflix", "graphql", "forks", "", 1, nil, nil),
+		},
+		{
+			desc: "orders",
+			old:  store.NewSnapshot(now, "netflix", "graphql", "stars", "", 1, nil, nil),
+			new:  store.NewSnapshot(now, "netflix", "graphql", "stars", topn.Ascending, 1, nil, nil),
+		},
+		{
+			desc: "n",
+			old:  store.NewSnapshot(now, "netflix", "graphql", "stars", "", 1, nil, nil),
+			new:  store.NewSnapshot(now, "netflix", "graphql", "stars", "", 2, nil, nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if _, err := store.Compare(tt.old, tt.new); err == nil {
+				t.Error("Compare() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestPair(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2020, 12, d, 9, 0, 0, 0, time.UTC)
+	}
+	snaps := []*store.Snapshot{
+		store.NewSnapshot(day(1), "netflix", "graphql", "stars", "", 10, nil, nil),
+		store.NewSnapshot(day(2), "netflix", "graphql", "prs", "", 10, nil, nil),
+		store.NewSnapshot(day(3), "netflix", "graphql", "stars", "", 10, nil, nil),
+		store.NewSnapshot(day(4), "netflix", "graphql", "stars", topn.Ascending, 10, nil, nil),
+		store.NewSnapshot(day(4).Add(time.Hour), "netflix", "rest", "stars", "", 10, nil, nil),
+		store.NewSnapshot(day(4).Add(2*time.Hour), "netflix", "graphql", "stars", "", 5, nil, nil),
+		store.NewSnapshot(day(5), "netflix", "graphql", "stars", "", 10, nil, nil),
+		store.NewSnapshot(day(6), "netflix", "graphql", "prs", "", 10, nil, nil),
+	}
+
+	tests := []struct {
+		desc     string
+		metric   string
+		from, to time.Time
+		wantOld  time.Time
+		wantNew  time.Time
+		wantErr  bool
+	}{
+		{
+			desc:    "latest two",
+			wantOld: day(2),
+			wantNew: day(6),
+		},
+		{
+			desc:    "by metric",
+			metric:  "stars",
+			wantOld: day(3),
+			wantNew: day(5),
+		},
+		{
+			desc:    "to",
+			to:      day(3).Add(time.Hour),
+			wantOld: day(1),
+			wantNew: day(3),
+		},
+		{
+			desc:    "from and to",
+			metric:  "stars",
+			from:    day(1),
+			to:      day(5),
+			wantOld: day(1),
+			wantNew: day(5),
+		},
+		{
+			desc:    "ascending",
+			to:      day(4),
+			wantErr: true,
+		},
+		{
+			desc:    "only snapshot listed with backend",
+			to:      day(4).Add(time.Hour),
+			wantErr: true,
+		},
+		{
+			desc:    "only snapshot of top-5",
+			to:      day(4).Add(2 * time.Hour),
+			wantErr: true,
+		},
+		{
+			desc:    "from after to",
+			metric:  "stars",
+			from:    day(5),
+			to:      day(3),
+			wantErr: true,
+		},
+		{
+			desc:    "unknown metric",
+			metric:  "forks",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			old, new, err := store.Pair(snaps, tt.metric, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Pair() got error %v, want error: %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if !old.Time.Equal(tt.wantOld) || !new.Time.Equal(tt.wantNew) {
+				t.Errorf("Pair() got snapshots from %v and %v, want %v and %v", old.Time, new.Time, tt.wantOld, tt.wantNew)
+			}
+		})
+	}
+}
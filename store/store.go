@@ -0,0 +1,204 @@
+// Package store persists the repos ranked by each run as snapshots, so how
+// repos' metrics change over time can be tracked across runs.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vtsao/repon/topn"
+)
+
+// Snapshot is the repos ranked for an owner by a single run.
+type Snapshot struct {
+	// Time is when the run started.
+	Time time.Time `json:"time"`
+	// Owner is the login of the organization or user that owns the repos.
+	Owner string `json:"owner"`
+	// Backend is the API the repos were listed with, "graphql" or "rest".
+	Backend string     `json:"backend"`
+	Metric  string     `json:"metric"`
+	Order   topn.Order `json:"order,omitempty"`
+	N       int        `json:"n"`
+	// Measured are the metrics that were measured for the repos. The repos
+	// don't have values for any other metric.
+	Measured []string `json:"measured,omitempty"`
+	// Repos are the ranked repos, in rank order.
+	Repos []Repo `json:"repos"`
+}
+
+// Repo is a ranked repo's metrics. Stars, forks and PRs are nil if they
+// weren't measured.
+type Repo struct {
+	Rank    int                `json:"rank"`
+	Name    string             `json:"name"`
+	Stars   *int               `json:"stars,omitempty"`
+	Forks   *int               `json:"forks,omitempty"`
+	PRs     *int               `json:"prs,omitempty"`
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+}
+
+// NewSnapshot returns a snapshot of the repos ranked for the owner, which are
+// in rank order, with the measured metrics.
+func NewSnapshot(t time.Time, owner, backend, metric string, order topn.Order, n int, measured []string, repos []*topn.Repo) *Snapshot {
+	s := &Snapshot{Time: t, Owner: owner, Backend: backend, Metric: metric, Order: order, N: n, Measured: measured, Repos: []Repo{}}
+	has := make(map[string]bool)
+	for _, name := range measured {
+		has[name] = true
+	}
+	value := func(name string, v int) *int {
+		if !has[name] {
+			return nil
+		}
+		return &v
+	}
+	for i, r := range repos {
+		var metrics map[string]float64
+		for name, v := range r.Metrics {
+			if !has[name] {
+				continue
+			}
+			if metrics == nil {
+				metrics = make(map[string]float64)
+			}
+			metrics[name] = v
+		}
+		s.Repos = append(s.Repos, Repo{
+			Rank:    i + 1,
+			Name:    r.Name,
+			Stars:   value("stars", r.Stars),
+			Forks:   value("forks", r.Forks),
+			PRs:     value("prs", r.PRs),
+			Metrics: metrics,
+		})
+	}
+	return s
+}
+
+// MeasuredMetrics returns the metrics that were measured for the snapshot's
+// repos. Snapshots stored before these were recorded have stars and forks,
+// which every backend lists, and PRs if they were listed with GraphQL or ranked
+// by them, along with the additional metrics their repos have values for.
+func (s *Snapshot) MeasuredMetrics() []string {
+	if s.Measured != nil {
+		return s.Measured
+	}
+	measured := []string{"stars", "forks"}
+	if s.Backend == "graphql" || s.Metric == "prs" {
+		measured = append(measured, "prs")
+	}
+	var extra []string
+	seen := make(map[string]bool)
+	for _, r := range s.Repos {
+		for name := range r.Metrics {
+			if !seen[name] {
+				seen[name] = true
+				extra = append(extra, name)
+			}
+		}
+	}
+	sort.Strings(extra)
+	return append(measured, extra...)
+}
+
+// TopN returns the snapshot's repos, in rank order.
+func (s *Snapshot) TopN() []*topn.Repo {
+	repos := make([]*topn.Repo, 0, len(s.Repos))
+	for _, r := range s.Repos {
+		repos = append(repos, &topn.Repo{
+			Owner:   s.Owner,
+			Name:    r.Name,
+			Stars:   deref(r.Stars),
+			Forks:   deref(r.Forks),
+			PRs:     deref(r.PRs),
+			Metrics: r.Metrics,
+		})
+	}
+	return repos
+}
+
+// deref returns the value of v, or 0 if it's nil.
+func deref(v *int) int {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// Store is a directory of snapshots, with a JSON Lines file per owner that
+// snapshots are appended to. Appends from concurrent runs don't interleave,
+// since each snapshot is a single write to a file opened for appending.
+type Store struct {
+	Dir string
+}
+
+// path returns the file the owner's snapshots are stored in. Logins are
+// case-insensitive, so the file name is lowercase.
+func (s *Store) path(owner string) (string, error) {
+	if owner == "" || strings.ContainsAny(owner, `/\`) || owner == "." || owner == ".." {
+		return "", fmt.Errorf("invalid owner %q", owner)
+	}
+	return filepath.Join(s.Dir, strings.ToLower(owner)+".jsonl"), nil
+}
+
+// Append appends the snapshot to its owner's file, creating the directory and
+// file if needed.
+func (s *Store) Append(snap *Snapshot) error {
+	path, err := s.path(snap.Owner)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Snapshots returns the owner's snapshots in the order they were appended, or
+// none if there aren't any.
+func (s *Store) Snapshots(owner string) ([]*Snapshot, error) {
+	path, err := s.path(owner)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var snaps []*Snapshot
+	dec := json.NewDecoder(f)
+	for {
+		snap := &Snapshot{}
+		err := dec.Decode(snap)
+		if err == io.EOF {
+			return snaps, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot %d of %s: %v", len(snaps)+1, path, err)
+		}
+		snaps = append(snaps, snap)
+	}
+}
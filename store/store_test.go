@@ -0,0 +1,156 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/store"
+	"github.com/vtsao/repon/topn"
+)
+
+func count(v int) *int {
+	return &v
+}
+
+func TestStore(t *testing.T) {
+	s := &store.Store{Dir: filepath.Join(t.TempDir(), "snapshots")}
+	monday := time.Date(2020, 12, 21, 9, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+
+	snaps := []*store.Snapshot{
+		store.NewSnapshot(monday, "netflix", "graphql", "stars", "", 2, []string{"stars", "forks", "prs"}, []*topn.Repo{
+			{Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555},
+			{Name: "Hystrix", Stars: 10248, Forks: 728},
+		}),
+		store.NewSnapshot(monday, "spinnaker", "graphql", "stars", "", 2, []string{"stars", "forks", "prs"}, nil),
+		// PRs weren't measured, so they're left out.
+		store.NewSnapshot(tuesday, "Netflix", "rest", "contribs", topn.Ascending, 1, []string{"stars", "forks", "contribs"}, []*topn.Repo{
+			{Name: "zuul", PRs: 2305, Metrics: map[string]float64{"contribs": 0, "issues": 3}},
+		}),
+	}
+	for _, snap := range snaps {
+		if err := s.Append(snap); err != nil {
+			t.Fatalf("Append(%q) failed: %v", snap.Owner, err)
+		}
+	}
+
+	tests := []struct {
+		owner string
+		want  []*store.Snapshot
+	}{
+		{
+			// Logins are case-insensitive.
+			owner: "NETFLIX",
+			want: []*store.Snapshot{
+				{
+					Time: monday, Owner: "netflix", Backend: "graphql", Metric: "stars", N: 2,
+					Measured: []string{"stars", "forks", "prs"},
+					Repos: []store.Repo{
+						{Rank: 1, Name: "metaflow", Stars: count(20787), Forks: count(2963), PRs: count(34555)},
+						{Rank: 2, Name: "Hystrix", Stars: count(10248), Forks: count(728), PRs: count(0)},
+					},
+				},
+				{
+					Time: tuesday, Owner: "Netflix", Backend: "rest", Metric: "contribs", Order: topn.Ascending, N: 1,
+					Measured: []string{"stars", "forks", "contribs"},
+					Repos: []store.Repo{
+						{Rank: 1, Name: "zuul", Stars: count(0), Forks: count(0), Metrics: map[string]float64{"contribs": 0}},
+					},
+				},
+			},
+		},
+		{
+			owner: "spinnaker",
+			want: []*store.Snapshot{
+				{Time: monday, Owner: "spinnaker", Backend: "graphql", Metric: "stars", N: 2, Measured: []string{"stars", "forks", "prs"}, Repos: []store.Repo{}},
+			},
+		},
+		{
+			owner: "alice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.owner, func(t *testing.T) {
+			got, err := s.Snapshots(tt.owner)
+			if err != nil {
+				t.Fatalf("Snapshots(%q) failed: %v", tt.owner, err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Snapshots(%q) got diff (-want +got):\n%s", tt.owner, diff)
+			}
+		})
+	}
+}
+
+func TestStoreBadOwner(t *testing.T) {
+	s := &store.Store{Dir: t.TempDir()}
+	for _, owner := range []string{"", "..", "netflix/../../etc"} {
+		if err := s.Append(store.NewSnapshot(time.Now(), owner, "graphql", "stars", "", 1, nil, nil)); err == nil {
+			t.Errorf("Append(%q) succeeded, want error", owner)
+		}
+	}
+}
+
+func TestStoreCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "netflix.jsonl"), []byte(`{"owner": "netflix"}`+"\n"+`{"owner": "net`), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+
+	s := &store.Store{Dir: dir}
+	if _, err := s.Snapshots("netflix"); err == nil {
+		t.Error(`Snapshots("netflix") succeeded, want error`)
+	}
+}
+
+func TestSnapshotTopN(t *testing.T) {
+	repos := []*topn.Repo{
+		{Owner: "netflix", Name: "metaflow", Stars: 20787, Forks: 2963, PRs: 34555, Metrics: map[string]float64{"contribs": 34555.0 / 2963}},
+		{Owner: "netflix", Name: "Hystrix", Stars: 10248, Forks: 728},
+	}
+	snap := store.NewSnapshot(time.Now(), "netflix", "graphql", "contribs", "", 2, []string{"stars", "forks", "prs", "contribs"}, repos)
+
+	if diff := cmp.Diff(repos, snap.TopN()); diff != "" {
+		t.Errorf("TopN() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSnapshotMeasuredMetrics(t *testing.T) {
+	dir := t.TempDir()
+	// Snapshots stored before the measured metrics were recorded.
+	legacy := `{"backend": "graphql", "metric": "stars", "repos": [{"name": "zuul", "stars": 1, "forks": 1, "prs": 1, "metrics": {"issues": 1}}]}
+{"backend": "rest", "metric": "stars", "repos": [{"name": "zuul", "stars": 1, "forks": 1, "prs": 0}]}
+{"backend": "rest", "metric": "prs", "repos": [{"name": "zuul", "stars": 1, "forks": 1, "prs": 1}]}
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "netflix.jsonl"), []byte(legacy), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	s := &store.Store{Dir: dir}
+	if err := s.Append(store.NewSnapshot(time.Now(), "netflix", "rest", "score", "", 1, []string{"stars", "forks", "issues", "score"}, nil)); err != nil {
+		t.Fatalf("Append() failed: %v", err)
+	}
+
+	snaps, err := s.Snapshots("netflix")
+	if err != nil {
+		t.Fatalf(`Snapshots("netflix") failed: %v`, err)
+	}
+	var got [][]string
+	for _, snap := range snaps {
+		got = append(got, snap.MeasuredMetrics())
+	}
+
+	want := [][]string{
+		{"stars", "forks", "prs", "issues"},
+		{"stars", "forks"},
+		{"stars", "forks", "prs"},
+		{"stars", "forks", "issues", "score"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("MeasuredMetrics() got diff (-want +got):\n%s", diff)
+	}
+}
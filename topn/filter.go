@@ -0,0 +1,149 @@
+package topn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Visibilities are the supported repo visibilities.
+var Visibilities = []string{"public", "private", "internal"}
+
+// Filter restricts which repos are ranked. Zero values don't filter.
+type Filter struct {
+	// Language is the repo's primary language, e.g. "Go".
+	Language string
+	// Topic is a topic the repo must have.
+	Topic string
+	// Archived and Mirror require the repo to be, or not be, archived or a
+	// mirror.
+	Archived *bool
+	Mirror   *bool
+	// Fork set to true only ranks forks. Otherwise forks are left out, like
+	// GitHub's repo search does by default.
+	Fork *bool
+	// Visibility is one of Visibilities.
+	Visibility string
+	// MinStars is the fewest stars the repo can have.
+	MinStars int
+	// PushedAfter requires the repo to have been pushed to after it.
+	PushedAfter time.Time
+	// Names filters repos by name. Names can't be searched for, so they're
+	// always filtered by Match.
+	Names *Names
+}
+
+// Attrs are the attributes of a repo that are filtered on.
+type Attrs struct {
+	Name       string
+	Language   string
+	Topics     []string
+	Archived   bool
+	Fork       bool
+	Mirror     bool
+	Visibility string
+	Stars      int
+	PushedAt   time.Time
+}
+
+// Validate returns an error if the filter is invalid.
+func (f *Filter) Validate() error {
+	if f.Visibility == "" {
+		return nil
+	}
+	for _, v := range Visibilities {
+		if f.Visibility == v {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown visibility %q, must be one of %q", f.Visibility, Visibilities)
+}
+
+// Forks returns whether only forks are ranked, rather than none.
+func (f *Filter) Forks() bool {
+	return f.Fork != nil && *f.Fork
+}
+
+// Qualifiers returns GitHub repo search qualifiers for the filter.
+//
+// See https://docs.github.com/en/free-pro-team@latest/github/searching-for-information-on-github/searching-for-repositories.
+func (f *Filter) Qualifiers() []string {
+	var qs []string
+	if f.Language != "" {
+		qs = append(qs, "language:"+quote(f.Language))
+	}
+	if f.Topic != "" {
+		qs = append(qs, "topic:"+quote(f.Topic))
+	}
+	if f.Archived != nil {
+		qs = append(qs, "archived:"+strconv.FormatBool(*f.Archived))
+	}
+	// Search leaves out forks by default.
+	if f.Forks() {
+		qs = append(qs, "fork:only")
+	}
+	if f.Mirror != nil {
+		qs = append(qs, "mirror:"+strconv.FormatBool(*f.Mirror))
+	}
+	if f.Visibility != "" {
+		qs = append(qs, "is:"+f.Visibility)
+	}
+	if f.MinStars > 0 {
+		qs = append(qs, "stars:>="+strconv.Itoa(f.MinStars))
+	}
+	if !f.PushedAfter.IsZero() {
+		qs = append(qs, "pushed:>"+f.PushedAfter.UTC().Format(time.RFC3339))
+	}
+	return qs
+}
+
+// quote quotes a qualifier value with spaces, e.g. "Jupyter Notebook".
+func quote(v string) string {
+	if strings.Contains(v, " ") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// Match returns whether a repo with the attributes passes the filter, for
+// backends that can't filter repos when listing them.
+func (f *Filter) Match(a Attrs) bool {
+	if !f.Names.Match(a.Name) {
+		return false
+	}
+	if f.Language != "" && !strings.EqualFold(f.Language, a.Language) {
+		return false
+	}
+	if f.Topic != "" && !hasTopic(a.Topics, f.Topic) {
+		return false
+	}
+	if f.Archived != nil && *f.Archived != a.Archived {
+		return false
+	}
+	if f.Forks() != a.Fork {
+		return false
+	}
+	if f.Mirror != nil && *f.Mirror != a.Mirror {
+		return false
+	}
+	if f.Visibility != "" && !strings.EqualFold(f.Visibility, a.Visibility) {
+		return false
+	}
+	if a.Stars < f.MinStars {
+		return false
+	}
+	if !f.PushedAfter.IsZero() && !a.PushedAt.After(f.PushedAfter) {
+		return false
+	}
+	return true
+}
+
+func hasTopic(topics []string, topic string) bool {
+	for _, t := range topics {
+		if strings.EqualFold(t, topic) {
+			return true
+		}
+	}
+	return false
+}
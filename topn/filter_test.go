@@ -0,0 +1,152 @@
+package topn_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/topn"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestFilterQualifiers(t *testing.T) {
+	tests := []struct {
+		desc   string
+		filter topn.Filter
+		want   []string
+	}{
+		{
+			// Search leaves out forks by default.
+			desc: "no filter",
+		},
+		{
+			desc: "every filter",
+			filter: topn.Filter{
+				Language:    "Jupyter Notebook",
+				Topic:       "ml",
+				Archived:    boolPtr(false),
+				Fork:        boolPtr(true),
+				Mirror:      boolPtr(false),
+				Visibility:  "internal",
+				MinStars:    100,
+				PushedAfter: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+			},
+			want: []string{
+				`language:"Jupyter Notebook"`,
+				"topic:ml",
+				"archived:false",
+				"fork:only",
+				"mirror:false",
+				"is:internal",
+				"stars:>=100",
+				"pushed:>2020-10-01T00:00:00Z",
+			},
+		},
+		{
+			desc:   "no forks",
+			filter: topn.Filter{Fork: boolPtr(false)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, tt.filter.Qualifiers()); diff != "" {
+				t.Errorf("Qualifiers() got diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	attrs := topn.Attrs{
+		Language:   "Go",
+		Topics:     []string{"cli", "GitHub"},
+		Visibility: "PUBLIC",
+		Stars:      10,
+		PushedAt:   time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		desc   string
+		filter topn.Filter
+		want   bool
+	}{
+		{
+			desc: "no filter",
+			want: true,
+		},
+		{
+			desc:   "language ignores case",
+			filter: topn.Filter{Language: "go"},
+			want:   true,
+		},
+		{
+			desc:   "other language",
+			filter: topn.Filter{Language: "Java"},
+		},
+		{
+			desc:   "topic ignores case",
+			filter: topn.Filter{Topic: "github"},
+			want:   true,
+		},
+		{
+			desc:   "missing topic",
+			filter: topn.Filter{Topic: "web"},
+		},
+		{
+			desc:   "not archived",
+			filter: topn.Filter{Archived: boolPtr(false)},
+			want:   true,
+		},
+		{
+			desc:   "not a fork",
+			filter: topn.Filter{Fork: boolPtr(false)},
+			want:   true,
+		},
+		{
+			desc:   "forks only",
+			filter: topn.Filter{Fork: boolPtr(true)},
+		},
+		{
+			desc:   "mirror",
+			filter: topn.Filter{Mirror: boolPtr(true)},
+		},
+		{
+			desc:   "visibility ignores case",
+			filter: topn.Filter{Visibility: "public"},
+			want:   true,
+		},
+		{
+			desc:   "exactly min stars",
+			filter: topn.Filter{MinStars: 10},
+			want:   true,
+		},
+		{
+			desc:   "too few stars",
+			filter: topn.Filter{MinStars: 11},
+		},
+		{
+			desc:   "pushed at the same time",
+			filter: topn.Filter{PushedAfter: attrs.PushedAt},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := tt.filter.Match(attrs); got != tt.want {
+				t.Errorf("Match(%+v) = %v, want %v", attrs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterMatchFork(t *testing.T) {
+	fork := topn.Attrs{Fork: true}
+	if (&topn.Filter{}).Match(fork) {
+		t.Error("Match() of a fork with no filter = true, want false")
+	}
+	if !(&topn.Filter{Fork: boolPtr(true)}).Match(fork) {
+		t.Error("Match() of a fork with Fork = true = false, want true")
+	}
+}
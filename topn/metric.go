@@ -0,0 +1,233 @@
+package topn
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Metric is a metric repos can be ranked by.
+type Metric struct {
+	// Name identifies the metric, e.g. on the command line.
+	Name string
+	// Desc describes the metric for humans.
+	Desc string
+	// Percent is whether the metric's value is a fraction that should be shown
+	// as a percentage.
+	Percent bool
+	// Decimals is the number of decimal places to show the metric's value with,
+	// or 0 to show as many as needed.
+	Decimals int
+	// Windowed is whether the metric only counts activity within a Window.
+	Windowed bool
+	// Value returns the repo's value for the metric.
+	Value func(r *Repo) float64
+}
+
+// Format formats the repo's value for the metric for humans.
+func (m *Metric) Format(r *Repo) string {
+	return m.FormatValue(m.Value(r))
+}
+
+// FormatValue formats a value of the metric for humans.
+func (m *Metric) FormatValue(v float64) string {
+	if m.Percent {
+		return strconv.FormatFloat(v*100, 'f', 2, 64) + "%"
+	}
+	if m.Decimals > 0 {
+		return strconv.FormatFloat(v, 'f', m.Decimals, 64)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// extra returns the value of an additional metric from the repo's Metrics.
+func extra(name string) func(r *Repo) float64 {
+	return func(r *Repo) float64 { return r.Metrics[name] }
+}
+
+// metrics is the registry of every metric repos can be ranked by. Metrics other
+// than stars, forks, and PRs are stored in Repo.Metrics under their name.
+var metrics = []*Metric{
+	{
+		Name:  "stars",
+		Desc:  "stars",
+		Value: func(r *Repo) float64 { return float64(r.Stars) },
+	},
+	{
+		Name:  "forks",
+		Desc:  "forks",
+		Value: func(r *Repo) float64 { return float64(r.Forks) },
+	},
+	{
+		Name:  "prs",
+		Desc:  "pull requests",
+		Value: func(r *Repo) float64 { return float64(r.PRs) },
+	},
+	{
+		Name:    "contribs",
+		Desc:    "contribution percentage",
+		Percent: true,
+		Value:   extra("contribs"),
+	},
+	{
+		Name:  "issues",
+		Desc:  "open issues",
+		Value: extra("issues"),
+	},
+	{
+		Name:  "watchers",
+		Desc:  "watchers",
+		Value: extra("watchers"),
+	},
+	{
+		Name:  "releases",
+		Desc:  "releases",
+		Value: extra("releases"),
+	},
+	{
+		Name:  "contributors",
+		Desc:  "contributors",
+		Value: extra("contributors"),
+	},
+	{
+		Name:  "commits",
+		Desc:  "commits on default branch",
+		Value: extra("commits"),
+	},
+	{
+		Name:  "size",
+		Desc:  "disk size in KB",
+		Value: extra("size"),
+	},
+	{
+		Name:     "prs_opened",
+		Desc:     "pull requests opened",
+		Windowed: true,
+		Value:    extra("prs_opened"),
+	},
+	{
+		Name:     "prs_merged",
+		Desc:     "pull requests merged",
+		Windowed: true,
+		Value:    extra("prs_merged"),
+	},
+	{
+		Name:     "issues_opened",
+		Desc:     "issues opened",
+		Windowed: true,
+		Value:    extra("issues_opened"),
+	},
+	{
+		Name:     "stars_gained",
+		Desc:     "stars gained",
+		Windowed: true,
+		Value:    extra("stars_gained"),
+	},
+	{
+		Name:     "forks_gained",
+		Desc:     "forks gained",
+		Windowed: true,
+		Value:    extra("forks_gained"),
+	},
+	{
+		Name:     "stars_velocity",
+		Desc:     "stars gained per day",
+		Decimals: 2,
+		Windowed: true,
+		Value:    extra("stars_velocity"),
+	},
+	{
+		Name:     "forks_velocity",
+		Desc:     "forks gained per day",
+		Decimals: 2,
+		Windowed: true,
+		Value:    extra("forks_velocity"),
+	},
+	{
+		Name:     "stars_weekly_velocity",
+		Desc:     "stars gained per week",
+		Decimals: 2,
+		Windowed: true,
+		Value:    extra("stars_weekly_velocity"),
+	},
+	{
+		Name:     "forks_weekly_velocity",
+		Desc:     "forks gained per week",
+		Decimals: 2,
+		Windowed: true,
+		Value:    extra("forks_weekly_velocity"),
+	},
+	{
+		Name:     "score",
+		Desc:     "score",
+		Decimals: 4,
+		Value:    extra("score"),
+	},
+}
+
+// Metrics returns every metric repos can be ranked by.
+func Metrics() []*Metric {
+	return metrics
+}
+
+// MetricNames returns the names of every metric repos can be ranked by.
+func MetricNames() []string {
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// LookupMetric returns the metric with the name, or false if there isn't one.
+func LookupMetric(name string) (*Metric, bool) {
+	for _, m := range metrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// Order is the order repos are ranked in by a metric.
+type Order string
+
+const (
+	// Descending ranks repos with the highest values first, which is the
+	// default.
+	Descending Order = "desc"
+	// Ascending ranks repos with the lowest values first, e.g. to find the
+	// least active repos.
+	Ascending Order = "asc"
+)
+
+// Orders returns the names of every order repos can be ranked in.
+func Orders() []string {
+	return []string{string(Descending), string(Ascending)}
+}
+
+// Validate returns an error if the order isn't one of Orders. The zero value is
+// valid, and means Descending.
+func (o Order) Validate() error {
+	switch o {
+	case "", Descending, Ascending:
+		return nil
+	}
+	return fmt.Errorf("unknown order %q, must be one of %q", string(o), Orders())
+}
+
+// Ascending returns whether repos are ranked lowest first.
+func (o Order) Ascending() bool {
+	return o == Ascending
+}
+
+// Sort sorts repos in the order by the metric. Repos with equal values keep
+// their original order.
+func Sort(repos []*Repo, m *Metric, order Order) {
+	sort.SliceStable(repos, func(i, j int) bool {
+		if order.Ascending() {
+			return m.Value(repos[i]) < m.Value(repos[j])
+		}
+		return m.Value(repos[i]) > m.Value(repos[j])
+	})
+}
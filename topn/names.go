@@ -0,0 +1,85 @@
+package topn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// Names filters repos by name with glob patterns, e.g. "sandbox-*".
+type Names struct {
+	include []glob.Glob
+	exclude []glob.Glob
+}
+
+// CompileNames compiles include and exclude glob patterns. If there are any
+// include patterns, a repo's name must match one of them, and it must not match
+// any exclude pattern.
+func CompileNames(include, exclude []string) (*Names, error) {
+	n := &Names{}
+	var err error
+	if n.include, err = compileGlobs(include); err != nil {
+		return nil, err
+	}
+	if n.exclude, err = compileGlobs(exclude); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	var globs []glob.Glob
+	for _, p := range patterns {
+		g, err := glob.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad glob pattern %q: %v", p, err)
+		}
+		globs = append(globs, g)
+	}
+	return globs, nil
+}
+
+// Match returns whether a repo named name passes the patterns. A nil Names
+// matches every name.
+func (n *Names) Match(name string) bool {
+	if n == nil {
+		return true
+	}
+	if len(n.include) > 0 && !matchAny(n.include, name) {
+		return false
+	}
+	return !matchAny(n.exclude, name)
+}
+
+func matchAny(globs []glob.Glob, name string) bool {
+	for _, g := range globs {
+		if g.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadPatterns reads glob patterns from a file with one pattern per line.
+// Patterns starting with "!" are exclude patterns and the rest are include
+// patterns. Blank lines and lines starting with "#" are ignored.
+func ReadPatterns(r io.Reader) (include, exclude []string, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "!"):
+			exclude = append(exclude, strings.TrimPrefix(line, "!"))
+		default:
+			include = append(include, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return include, exclude, nil
+}
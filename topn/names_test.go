@@ -0,0 +1,79 @@
+package topn_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/topn"
+)
+
+func TestNamesMatch(t *testing.T) {
+	tests := []struct {
+		desc             string
+		include, exclude []string
+		want             map[string]bool
+	}{
+		{
+			desc: "no patterns",
+			want: map[string]bool{"repon": true, "sandbox-repon": true},
+		},
+		{
+			desc:    "include",
+			include: []string{"repon*", "go-*"},
+			want:    map[string]bool{"repon": true, "repon-archive": true, "go-github": true, "githubv4": false},
+		},
+		{
+			desc:    "exclude",
+			exclude: []string{"*-archive", "sandbox-*"},
+			want:    map[string]bool{"repon": true, "repon-archive": false, "sandbox-repon": false},
+		},
+		{
+			desc:    "exclude wins over include",
+			include: []string{"repon*"},
+			exclude: []string{"*-archive"},
+			want:    map[string]bool{"repon": true, "repon-archive": false, "githubv4": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			names, err := topn.CompileNames(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("CompileNames(%q, %q) failed: %v", tt.include, tt.exclude, err)
+			}
+			got := make(map[string]bool)
+			for name := range tt.want {
+				got[name] = names.Match(name)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Match() got diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCompileNamesBadPattern(t *testing.T) {
+	if _, err := topn.CompileNames([]string{"repon["}, nil); err == nil {
+		t.Error(`CompileNames(["repon["], nil) succeeded, want error`)
+	}
+}
+
+func TestReadPatterns(t *testing.T) {
+	const config = `# Leave out noise.
+!*-archive
+!sandbox-*
+
+repon*
+`
+	include, exclude, err := topn.ReadPatterns(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ReadPatterns() failed: %v", err)
+	}
+	if diff := cmp.Diff([]string{"repon*"}, include); diff != "" {
+		t.Errorf("ReadPatterns() got include diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"*-archive", "sandbox-*"}, exclude); diff != "" {
+		t.Errorf("ReadPatterns() got exclude diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,78 @@
+package topn_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-github/v33/github"
+	"github.com/shurcooL/githubv4"
+	"github.com/vtsao/repon/internal/fakegithub"
+	"github.com/vtsao/repon/repo"
+	"github.com/vtsao/repon/repoql"
+	"github.com/vtsao/repon/topn"
+)
+
+func names(repos []*topn.Repo) []string {
+	var names []string
+	for _, r := range repos {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// TestBackendParity checks that the REST and GraphQL backends return the same
+// rankings for the same data.
+func TestBackendParity(t *testing.T) {
+	ctx := context.Background()
+
+	fixtures := []struct {
+		desc  string
+		repos []fakegithub.Repo
+	}{
+		{
+			desc:  "netflix",
+			repos: fakegithub.Netflix(),
+		},
+		{
+			desc:  "large org",
+			repos: fakegithub.Generate(1050),
+		},
+	}
+
+	for _, f := range fixtures {
+		restServ := fakegithub.NewRESTServer(t, f.repos)
+		defer restServ.Close()
+		restClient := github.NewClient(nil)
+		restClient.BaseURL = fakegithub.BaseURL(t, restServ)
+
+		qlServ := fakegithub.NewGraphQLServer(t, f.repos)
+		defer qlServ.Close()
+
+		restBackend := &repo.TopN{Client: restClient, FillPRsConcurrency: 10, Window: fakegithub.Q4}
+		qlBackend := &repoql.TopN{
+			Client: githubv4.NewEnterpriseClient(qlServ.URL+"/graphql", nil),
+			Window: fakegithub.Q4,
+		}
+
+		for _, metric := range []string{"stars", "forks", "prs", "contribs", "issues", "watchers", "releases", "commits", "size", "prs_opened", "prs_merged", "issues_opened", "stars_gained", "forks_gained", "stars_velocity", "forks_velocity", "stars_weekly_velocity", "forks_weekly_velocity"} {
+			for _, n := range []int{3, 10} {
+				t.Run(fmt.Sprintf("%s top-%d by %s", f.desc, n, metric), func(t *testing.T) {
+					rest, err := restBackend.List(ctx, "netflix", n, metric)
+					if err != nil {
+						t.Fatalf(`repo List("netflix", %d, %q) failed: %v`, n, metric, err)
+					}
+					ql, err := qlBackend.List(ctx, "netflix", n, metric)
+					if err != nil {
+						t.Fatalf(`repoql List("netflix", %d, %q) failed: %v`, n, metric, err)
+					}
+
+					if diff := cmp.Diff(names(ql), names(rest)); diff != "" {
+						t.Errorf(`List("netflix", %d, %q) rankings differ (-repoql +repo):\n%s`, n, metric, diff)
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package topn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// normalizers normalize a metric's values across the repos in an org, so
+// metrics with different scales can be weighted against each other.
+var normalizers = map[string]func(values []float64){
+	"none": func(values []float64) {},
+	"minmax": func(values []float64) {
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, v := range values {
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+		}
+		for i, v := range values {
+			if max == min {
+				values[i] = 0
+				continue
+			}
+			values[i] = (v - min) / (max - min)
+		}
+	},
+	"zscore": func(values []float64) {
+		if len(values) == 0 {
+			return
+		}
+		mean := 0.0
+		for _, v := range values {
+			mean += v
+		}
+		mean /= float64(len(values))
+		variance := 0.0
+		for _, v := range values {
+			variance += (v - mean) * (v - mean)
+		}
+		stddev := math.Sqrt(variance / float64(len(values)))
+		for i, v := range values {
+			if stddev == 0 {
+				values[i] = 0
+				continue
+			}
+			values[i] = (v - mean) / stddev
+		}
+	},
+	"log": func(values []float64) {
+		for i, v := range values {
+			values[i] = math.Log1p(math.Max(v, 0))
+		}
+	},
+}
+
+// Normalizations returns the names of the supported normalizations in sorted
+// order.
+func Normalizations() []string {
+	var names []string
+	for name := range normalizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Score is a composite metric that is the weighted sum of other metrics.
+type Score struct {
+	// Weights are the weights of each metric by name.
+	Weights map[string]float64
+	// Normalize is how each metric is normalized across the repos in an org
+	// before weighting, one of Normalizations. Empty means "none".
+	Normalize string
+}
+
+// Metrics returns the names of the metrics the score is made of in sorted
+// order.
+func (s *Score) Metrics() []string {
+	var names []string
+	for name := range s.Weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate returns an error if the score can't be computed.
+func (s *Score) Validate() error {
+	if len(s.Weights) == 0 {
+		return fmt.Errorf("score has no weights")
+	}
+	for _, name := range s.Metrics() {
+		if name == "score" {
+			return fmt.Errorf("score can't be weighted by itself")
+		}
+		if _, ok := LookupMetric(name); !ok {
+			return fmt.Errorf("unknown metric %q in score weights", name)
+		}
+	}
+	if _, ok := normalizers[s.normalize()]; !ok {
+		return fmt.Errorf("unknown normalization %q, must be one of %q", s.Normalize, Normalizations())
+	}
+	return nil
+}
+
+// Relative returns whether the score's normalization depends on the other
+// repos in the org, so scores of repos in different orgs aren't comparable.
+func (s *Score) Relative() bool {
+	return s.normalize() == "minmax" || s.normalize() == "zscore"
+}
+
+func (s *Score) normalize() string {
+	if s.Normalize == "" {
+		return "none"
+	}
+	return s.Normalize
+}
+
+// Set sets the "score" metric of every repo. Since metrics are normalized
+// across repos, repos must be every repo in the org rather than just the top n.
+func (s *Score) Set(repos []*Repo) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	scores := make([]float64, len(repos))
+	for _, name := range s.Metrics() {
+		m, _ := LookupMetric(name)
+		values := make([]float64, len(repos))
+		for i, r := range repos {
+			values[i] = m.Value(r)
+		}
+		normalizers[s.normalize()](values)
+		for i, v := range values {
+			scores[i] += s.Weights[name] * v
+		}
+	}
+
+	for i, r := range repos {
+		r.SetMetric("score", scores[i])
+	}
+	return nil
+}
+
+// Components returns the metrics that need to be filled in to rank repos by
+// metric, which is the metric itself or, for "score", the metrics the score is
+// made of. Velocity metrics are preceded by the windowed metric they're derived
+// from, which backends fill in before calling SetVelocities.
+func Components(metric string, score *Score) ([]string, error) {
+	metrics := []string{metric}
+	if metric == "score" {
+		if score == nil {
+			return nil, fmt.Errorf("metric %q requires weights", metric)
+		}
+		if err := score.Validate(); err != nil {
+			return nil, err
+		}
+		metrics = score.Metrics()
+	}
+
+	var components []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			components = append(components, name)
+		}
+	}
+	for _, m := range metrics {
+		if v, ok := velocities[m]; ok {
+			add(v.from)
+		}
+		add(m)
+	}
+	return components, nil
+}
+
+// ParseWeights parses weights of the form "stars=0.5,prs=0.3,forks=0.2".
+func ParseWeights(s string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(s, ",") {
+		if err := parseWeight(weights, pair); err != nil {
+			return nil, err
+		}
+	}
+	return weights, nil
+}
+
+// ReadWeights reads weights from a config file with one "metric=weight" pair
+// per line. Blank lines and lines starting with "#" are ignored.
+func ReadWeights(r io.Reader) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := parseWeight(weights, line); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return weights, nil
+}
+
+// parseWeight parses a single "metric=weight" pair into weights.
+func parseWeight(weights map[string]float64, pair string) error {
+	parts := strings.SplitN(pair, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("weight %q must be of the form metric=weight", pair)
+	}
+	name := strings.TrimSpace(parts[0])
+	weight, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return fmt.Errorf("weight %q must be a number: %v", pair, err)
+	}
+	if _, ok := weights[name]; ok {
+		return fmt.Errorf("metric %q is weighted more than once", name)
+	}
+	weights[name] = weight
+	return nil
+}
@@ -0,0 +1,169 @@
+package topn_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/vtsao/repon/topn"
+)
+
+func TestScoreSet(t *testing.T) {
+	weights := map[string]float64{"stars": 1, "forks": 0.5}
+	// The z-score of the highest and lowest stars and forks below.
+	z := math.Sqrt(1.5)
+
+	tests := []struct {
+		normalize string
+		want      []float64
+	}{
+		{
+			normalize: "none",
+			want:      []float64{10, 2, 6},
+		},
+		{
+			normalize: "minmax",
+			want:      []float64{1, 0.5, 0.75},
+		},
+		{
+			normalize: "zscore",
+			want:      []float64{z - 0.5*z, -z + 0.5*z, 0},
+		},
+		{
+			normalize: "log",
+			want:      []float64{math.Log1p(10), 0.5 * math.Log1p(4), 0.5*math.Log1p(2) + math.Log1p(5)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.normalize, func(t *testing.T) {
+			repos := []*topn.Repo{
+				{Name: "a", Stars: 10, Forks: 0},
+				{Name: "b", Stars: 0, Forks: 4},
+				{Name: "c", Stars: 5, Forks: 2},
+			}
+			score := &topn.Score{Weights: weights, Normalize: tt.normalize}
+			if err := score.Set(repos); err != nil {
+				t.Fatalf("Set() failed: %v", err)
+			}
+
+			var got []float64
+			for _, r := range repos {
+				got = append(got, r.Metrics["score"])
+			}
+			if diff := cmp.Diff(tt.want, got, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("Set() got scores diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestScoreValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		score   *topn.Score
+		wantErr bool
+	}{
+		{
+			desc:  "valid",
+			score: &topn.Score{Weights: map[string]float64{"stars": 0.5, "prs": 0.5}, Normalize: "log"},
+		},
+		{
+			desc:    "no weights",
+			score:   &topn.Score{},
+			wantErr: true,
+		},
+		{
+			desc:    "unknown metric",
+			score:   &topn.Score{Weights: map[string]float64{"likes": 1}},
+			wantErr: true,
+		},
+		{
+			desc:    "weighted by itself",
+			score:   &topn.Score{Weights: map[string]float64{"score": 1}},
+			wantErr: true,
+		},
+		{
+			desc:    "unknown normalization",
+			score:   &topn.Score{Weights: map[string]float64{"stars": 1}, Normalize: "sqrt"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if err := tt.score.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScoreRelative(t *testing.T) {
+	for normalize, want := range map[string]bool{"": false, "none": false, "log": false, "minmax": true, "zscore": true} {
+		s := &topn.Score{Weights: map[string]float64{"stars": 1}, Normalize: normalize}
+		if got := s.Relative(); got != want {
+			t.Errorf("Relative() with normalization %q got %v, want %v", normalize, got, want)
+		}
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{
+			s:    "stars=0.5,prs=0.3,forks=0.2",
+			want: map[string]float64{"stars": 0.5, "prs": 0.3, "forks": 0.2},
+		},
+		{
+			s:    " stars = 1 ",
+			want: map[string]float64{"stars": 1},
+		},
+		{
+			s:       "stars",
+			wantErr: true,
+		},
+		{
+			s:       "stars=lots",
+			wantErr: true,
+		},
+		{
+			s:       "stars=1,stars=2",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := topn.ParseWeights(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWeights(%q) got error %v, want error: %v", tt.s, err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ParseWeights(%q) got diff (-want +got):\n%s", tt.s, diff)
+			}
+		})
+	}
+}
+
+func TestReadWeights(t *testing.T) {
+	const config = `# Weights for investment decisions.
+stars=0.5
+
+prs=0.3
+forks=0.2
+`
+	got, err := topn.ReadWeights(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ReadWeights() failed: %v", err)
+	}
+	want := map[string]float64{"stars": 0.5, "prs": 0.3, "forks": 0.2}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ReadWeights() got diff (-want +got):\n%s", diff)
+	}
+}
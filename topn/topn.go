@@ -0,0 +1,127 @@
+// Package topn defines the types shared by the backends that find the top-n
+// GitHub repositories in an organization, so consumers can switch between the
+// GitHub REST API and GitHub GraphQL API without caring which one is used.
+package topn
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Repo holds the metrics for a GitHub repository as returned by a Backend.
+// Backends only measure the metrics returned by Backend.Measured, and leave
+// the rest zero or out of Metrics. For example, the REST backend only counts
+// PRs when ranking by them, since that takes a request per repo, while the
+// GraphQL backend always counts them.
+type Repo struct {
+	// Owner is the login of the organization or user that owns the repo. It's
+	// only set when listing repos for multiple owners with ListOwners.
+	Owner string
+	Name  string
+	Stars int
+	Forks int
+	PRs   int
+	// Metrics holds additional metric values keyed by metric name, e.g.
+	// "contribs", for metrics that are derived or only filled in when requested.
+	Metrics map[string]float64
+}
+
+// SetMetric sets the value of an additional metric.
+func (r *Repo) SetMetric(name string, value float64) {
+	if r.Metrics == nil {
+		r.Metrics = make(map[string]float64)
+	}
+	r.Metrics[name] = value
+}
+
+// Backend finds the top-n GitHub repos in an org based on a metric.
+type Backend interface {
+	// List returns the top-n GitHub repos for the org by metric.
+	List(ctx context.Context, org string, n int, metric string) ([]*Repo, error)
+	// Measured returns the metrics List measures for every repo when listing
+	// repos by metric.
+	Measured(metric string) []string
+}
+
+// Measured returns the metrics measured for every repo ranked by metric, which
+// are the metrics always measured followed by the metric and those it's made
+// of, see Components.
+func Measured(always []string, metric string, score *Score) []string {
+	components, _ := Components(metric, score)
+	var measured []string
+	seen := make(map[string]bool)
+	for _, m := range append(append(always, components...), metric) {
+		if !seen[m] {
+			seen[m] = true
+			measured = append(measured, m)
+		}
+	}
+	return measured
+}
+
+// MetricChecker is implemented by backends that can't list repos by every
+// metric, so callers can reject a metric before listing any repos.
+type MetricChecker interface {
+	// CheckMetric returns an error if the backend can't list repos by metric.
+	CheckMetric(metric string) error
+}
+
+// Contribs returns the contribution percentage (PRs/forks) as a fraction,
+// which is 0 if there are no forks.
+func Contribs(prs, forks int) float64 {
+	if forks == 0 {
+		return 0
+	}
+	return float64(prs) / float64(forks)
+}
+
+// Owner is a GitHub organization or user account to list repos for.
+type Owner struct {
+	Login string
+	// Backend lists the owner's repos, which depends on whether the owner is an
+	// organization or user for some backends.
+	Backend Backend
+}
+
+// ListOwners lists the top-n GitHub repos for each owner by metric
+// concurrently. The repos are returned in the order of owners, each owner's
+// sorted by metric, with Repo.Owner set.
+func ListOwners(ctx context.Context, owners []Owner, n int, metric string) ([]*Repo, error) {
+	results := make([][]*Repo, len(owners))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, owner := range owners {
+		i, owner := i, owner
+		g.Go(func() error {
+			repos, err := owner.Backend.List(gctx, owner.Login, n, metric)
+			if err != nil {
+				return fmt.Errorf("listing repos for %q: %v", owner.Login, err)
+			}
+			for _, r := range repos {
+				r.Owner = owner.Login
+			}
+			results[i] = repos
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	var all []*Repo
+	for _, repos := range results {
+		all = append(all, repos...)
+	}
+	return all, nil
+}
+
+// Top returns the top-n repos by the metric in the order, e.g. to merge the
+// repos of multiple owners into one leaderboard. repos is sorted in place.
+func Top(repos []*Repo, m *Metric, order Order, n int) []*Repo {
+	Sort(repos, m, order)
+	if n > len(repos) {
+		n = len(repos)
+	}
+	return repos[:n]
+}
@@ -0,0 +1,264 @@
+package topn_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/topn"
+)
+
+func TestContribs(t *testing.T) {
+	tests := []struct {
+		desc  string
+		prs   int
+		forks int
+		want  float64
+	}{
+		{
+			desc:  "no forks",
+			prs:   10,
+			forks: 0,
+			want:  0,
+		},
+		{
+			desc:  "no prs",
+			prs:   0,
+			forks: 10,
+			want:  0,
+		},
+		{
+			desc:  "prs and forks",
+			prs:   5,
+			forks: 10,
+			want:  0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := topn.Contribs(tt.prs, tt.forks); got != tt.want {
+				t.Errorf("Contribs(%d, %d) = %v, want %v", tt.prs, tt.forks, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowQualifier(t *testing.T) {
+	since := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc   string
+		window topn.Window
+		want   string
+	}{
+		{
+			desc:   "since and until",
+			window: topn.Window{Since: since, Until: until},
+			want:   "created:2020-10-01T00:00:00Z..2020-12-31T00:00:00Z",
+		},
+		{
+			desc:   "only since",
+			window: topn.Window{Since: since},
+			want:   "created:2020-10-01T00:00:00Z..*",
+		},
+		{
+			desc:   "only until in another time zone",
+			window: topn.Window{Until: until.In(time.FixedZone("PST", -8*60*60))},
+			want:   "created:*..2020-12-31T00:00:00Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := tt.window.Qualifier("created"); got != tt.want {
+				t.Errorf("Qualifier(%q) = %q, want %q", "created", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	since := time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc   string
+		window topn.Window
+		t      time.Time
+		want   bool
+	}{
+		{
+			desc:   "within",
+			window: topn.Window{Since: since, Until: until},
+			t:      since.AddDate(0, 1, 0),
+			want:   true,
+		},
+		{
+			desc:   "at since",
+			window: topn.Window{Since: since, Until: until},
+			t:      since,
+			want:   true,
+		},
+		{
+			desc:   "before since",
+			window: topn.Window{Since: since, Until: until},
+			t:      since.Add(-time.Second),
+			want:   false,
+		},
+		{
+			desc:   "after until",
+			window: topn.Window{Since: since, Until: until},
+			t:      until.Add(time.Second),
+			want:   false,
+		},
+		{
+			desc:   "open window",
+			window: topn.Window{},
+			t:      until.AddDate(10, 0, 0),
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			if got := tt.window.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+// backendFunc is a topn.Backend that lists repos with a func.
+type backendFunc func(ctx context.Context, org string, n int, metric string) ([]*topn.Repo, error)
+
+func (f backendFunc) List(ctx context.Context, org string, n int, metric string) ([]*topn.Repo, error) {
+	return f(ctx, org, n, metric)
+}
+
+func (f backendFunc) Measured(metric string) []string {
+	return []string{"stars", "forks", metric}
+}
+
+func TestListOwners(t *testing.T) {
+	// Each owner has one repo named after it with stars equal to the length of
+	// its name.
+	backend := backendFunc(func(ctx context.Context, org string, n int, metric string) ([]*topn.Repo, error) {
+		if org == "broken" {
+			return nil, errors.New("broken")
+		}
+		return []*topn.Repo{{Name: org + "-repo", Stars: len(org)}}, nil
+	})
+
+	tests := []struct {
+		desc      string
+		owners    []topn.Owner
+		wantRepos []*topn.Repo
+		wantErr   bool
+	}{
+		{
+			desc: "orgs and users",
+			owners: []topn.Owner{
+				{Login: "netflix", Backend: backend},
+				{Login: "alice", Backend: backend},
+				{Login: "spinnaker", Backend: backend},
+			},
+			wantRepos: []*topn.Repo{
+				{Owner: "netflix", Name: "netflix-repo", Stars: 7},
+				{Owner: "alice", Name: "alice-repo", Stars: 5},
+				{Owner: "spinnaker", Name: "spinnaker-repo", Stars: 9},
+			},
+		},
+		{
+			desc: "owner fails",
+			owners: []topn.Owner{
+				{Login: "netflix", Backend: backend},
+				{Login: "broken", Backend: backend},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			repos, err := topn.ListOwners(context.Background(), tt.owners, 3, "stars")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListOwners() got error %v, want error: %v", err, tt.wantErr)
+			}
+
+			if diff := cmp.Diff(tt.wantRepos, repos); diff != "" {
+				t.Errorf("ListOwners() got diff (-want +got):\n%s", diff)
+			}
+
+			// The merged leaderboard is ranked across owners.
+			m, _ := topn.LookupMetric("stars")
+			if top := topn.Top(repos, m, topn.Descending, 2); len(repos) > 0 && (top[0].Owner != "spinnaker" || top[1].Owner != "netflix") {
+				t.Errorf("Top(2) got owners %q and %q, want spinnaker and netflix", top[0].Owner, top[1].Owner)
+			}
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	repos := func() []*topn.Repo {
+		return []*topn.Repo{
+			{Name: "a", Stars: 5},
+			{Name: "b", Stars: 9},
+			{Name: "c", Stars: 1},
+			{Name: "d", Stars: 5},
+		}
+	}
+
+	tests := []struct {
+		order     topn.Order
+		wantNames []string
+	}{
+		{order: "", wantNames: []string{"b", "a", "d", "c"}},
+		{order: topn.Descending, wantNames: []string{"b", "a", "d", "c"}},
+		// Ties keep their original order either way.
+		{order: topn.Ascending, wantNames: []string{"c", "a", "d", "b"}},
+	}
+
+	m, _ := topn.LookupMetric("stars")
+	for _, tt := range tests {
+		t.Run(string(tt.order), func(t *testing.T) {
+			rs := repos()
+			topn.Sort(rs, m, tt.order)
+			var names []string
+			for _, r := range rs {
+				names = append(names, r.Name)
+			}
+			if diff := cmp.Diff(tt.wantNames, names); diff != "" {
+				t.Errorf("Sort(%q) got diff (-want +got):\n%s", tt.order, diff)
+			}
+		})
+	}
+
+	if err := topn.Order("up").Validate(); err == nil {
+		t.Error(`Order("up").Validate() succeeded, want error`)
+	}
+}
+
+func TestMeasured(t *testing.T) {
+	score := &topn.Score{Weights: map[string]float64{"prs": 1, "stars_velocity": 1}}
+	tests := []struct {
+		metric string
+		want   []string
+	}{
+		{metric: "stars", want: []string{"stars", "forks"}},
+		{metric: "prs", want: []string{"stars", "forks", "prs"}},
+		{metric: "score", want: []string{"stars", "forks", "prs", "stars_gained", "stars_velocity", "score"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			got := topn.Measured([]string{"stars", "forks"}, tt.metric, score)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Measured(%q) got diff (-want +got):\n%s", tt.metric, diff)
+			}
+		})
+	}
+}
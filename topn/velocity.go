@@ -0,0 +1,40 @@
+package topn
+
+// velocity is a metric that is the rate of a windowed metric.
+type velocity struct {
+	// from is the windowed metric the rate is of.
+	from string
+	// days is the number of days the rate is per.
+	days float64
+}
+
+// velocities are the metrics that are the daily or weekly rate of a windowed
+// metric, by name.
+var velocities = map[string]velocity{
+	"stars_velocity":        {from: "stars_gained", days: 1},
+	"forks_velocity":        {from: "forks_gained", days: 1},
+	"stars_weekly_velocity": {from: "stars_gained", days: 7},
+	"forks_weekly_velocity": {from: "forks_gained", days: 7},
+}
+
+// SetVelocities sets the velocity metrics among metrics, such as
+// stars_velocity, for every repo from the windowed metric they're derived from
+// and the length of the window. The windowed metrics, which are the raw change
+// in the window, must already be set. A window with no length, e.g. one that
+// starts in the future, has no rate, so the velocities are 0.
+func SetVelocities(repos []*Repo, metrics []string, w Window) {
+	days := w.Days()
+	for _, metric := range metrics {
+		v, ok := velocities[metric]
+		if !ok {
+			continue
+		}
+		for _, r := range repos {
+			rate := 0.0
+			if days > 0 {
+				rate = r.Metrics[v.from] / days * v.days
+			}
+			r.SetMetric(metric, rate)
+		}
+	}
+}
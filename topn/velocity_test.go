@@ -0,0 +1,86 @@
+package topn_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/vtsao/repon/topn"
+)
+
+func TestComponents(t *testing.T) {
+	tests := []struct {
+		metric string
+		score  *topn.Score
+		want   []string
+	}{
+		{metric: "stars", want: []string{"stars"}},
+		{metric: "stars_velocity", want: []string{"stars_gained", "stars_velocity"}},
+		{metric: "forks_weekly_velocity", want: []string{"forks_gained", "forks_weekly_velocity"}},
+		{
+			metric: "score",
+			score:  &topn.Score{Weights: map[string]float64{"forks_velocity": 1, "forks_gained": 1, "stars": 1}},
+			want:   []string{"forks_gained", "forks_velocity", "stars"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			got, err := topn.Components(tt.metric, tt.score)
+			if err != nil {
+				t.Fatalf("Components(%q) failed: %v", tt.metric, err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Components(%q) got diff (-want +got):\n%s", tt.metric, diff)
+			}
+		})
+	}
+}
+
+func TestSetVelocities(t *testing.T) {
+	since := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	w := topn.Window{Since: since, Until: since.AddDate(0, 0, 14)}
+	repos := []*topn.Repo{
+		{Name: "metaflow", Metrics: map[string]float64{"stars_gained": 70, "forks_gained": 7}},
+		{Name: "zuul", Metrics: map[string]float64{"stars_gained": 0}},
+	}
+
+	topn.SetVelocities(repos, []string{"stars_gained", "stars_velocity", "forks_velocity", "stars_weekly_velocity"}, w)
+
+	want := []*topn.Repo{
+		{Name: "metaflow", Metrics: map[string]float64{"stars_gained": 70, "stars_velocity": 5, "forks_gained": 7, "forks_velocity": 0.5, "stars_weekly_velocity": 35}},
+		{Name: "zuul", Metrics: map[string]float64{"stars_gained": 0, "stars_velocity": 0, "forks_velocity": 0, "stars_weekly_velocity": 0}},
+	}
+	if diff := cmp.Diff(want, repos); diff != "" {
+		t.Errorf("SetVelocities() got diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetVelocitiesEmptyWindow(t *testing.T) {
+	since := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	repos := []*topn.Repo{{Name: "metaflow", Metrics: map[string]float64{"stars_gained": 70}}}
+
+	topn.SetVelocities(repos, []string{"stars_gained", "stars_velocity"}, topn.Window{Since: since, Until: since})
+
+	// The rate of a window with no length would be infinite.
+	if got := repos[0].Metrics["stars_velocity"]; got != 0 {
+		t.Errorf("SetVelocities() got stars_velocity %v, want 0", got)
+	}
+}
+
+func TestWindowDays(t *testing.T) {
+	since := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	if got, want := (topn.Window{Since: since, Until: since.Add(36 * time.Hour)}).Days(), 1.5; got != want {
+		t.Errorf("Days() got %v, want %v", got, want)
+	}
+	// An open end is now.
+	min := time.Since(since).Hours() / 24
+	if got := (topn.Window{Since: since}).Days(); got < min {
+		t.Errorf("Days() got %v, want at least %v", got, min)
+	}
+	if got := (topn.Window{}).Days(); !math.IsInf(got, 1) {
+		t.Errorf("Days() got %v, want +Inf", got)
+	}
+}
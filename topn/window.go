@@ -0,0 +1,58 @@
+package topn
+
+import (
+	"math"
+	"time"
+)
+
+// Window is a time window that windowed metrics, such as PRs opened, count
+// activity in. A zero Since or Until leaves that end of the window open.
+type Window struct {
+	Since time.Time
+	Until time.Time
+}
+
+// Contains returns whether t is within the window, including both ends.
+func (w Window) Contains(t time.Time) bool {
+	if !w.Since.IsZero() && t.Before(w.Since) {
+		return false
+	}
+	if !w.Until.IsZero() && t.After(w.Until) {
+		return false
+	}
+	return true
+}
+
+// Before returns whether t is before the start of the window.
+func (w Window) Before(t time.Time) bool {
+	return !w.Since.IsZero() && t.Before(w.Since)
+}
+
+// Days returns the length of the window in days, where an open Until is now.
+// It's infinite if Since is open.
+func (w Window) Days() float64 {
+	if w.Since.IsZero() {
+		return math.Inf(1)
+	}
+	until := w.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+	return until.Sub(w.Since).Hours() / 24
+}
+
+// Qualifier returns a GitHub search qualifier that restricts the date field,
+// e.g. "created", to the window.
+//
+// See https://docs.github.com/en/free-pro-team@latest/github/searching-for-information-on-github/understanding-the-search-syntax#query-for-dates.
+func (w Window) Qualifier(field string) string {
+	return field + ":" + searchDate(w.Since) + ".." + searchDate(w.Until)
+}
+
+// searchDate formats t for a search qualifier, where a zero t is unbounded.
+func searchDate(t time.Time) string {
+	if t.IsZero() {
+		return "*"
+	}
+	return t.UTC().Format(time.RFC3339)
+}